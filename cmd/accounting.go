@@ -0,0 +1,171 @@
+package cmd
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+
+	"github.com/maxmind/mmdbwriter"
+	"github.com/maxmind/mmdbwriter/inserter"
+	"github.com/maxmind/mmdbwriter/mmdbtype"
+)
+
+// Reasons an import entry can be rejected.
+const (
+	reasonInvalid  = "skipped_invalid"
+	reasonReserved = "skipped_reserved"
+	reasonFailed   = "insert_failed"
+	reasonPartial  = "partial_insert"
+)
+
+// importCounts counts the outcome of every entry in the import input.
+// Merged entries are inserted entries that a merge strategy other than none
+// combined with existing data, null
+// entries are null records dropped by --null omit, and partial entries are
+// ranges of which only some prefixes could be written.
+type importCounts struct {
+	Inserted        int `json:"inserted"`
+	SkippedInvalid  int `json:"skipped_invalid"`
+	SkippedReserved int `json:"skipped_reserved"`
+	SkippedNull     int `json:"skipped_null"`
+	InsertFailed    int `json:"insert_failed"`
+	PartialInsert   int `json:"partial_insert"`
+	Merged          int `json:"merged"`
+}
+
+// rejectedEntry is an input key that was not, or for partial inserts not
+// completely, written to the database. Written lists the prefixes of a
+// partial insert that were written.
+type rejectedEntry struct {
+	Source   string   `json:"source"`
+	Key      string   `json:"key"`
+	Position int      `json:"position"`
+	Reason   string   `json:"reason"`
+	Error    string   `json:"error"`
+	Written  []string `json:"written,omitempty"`
+}
+
+// importAccounting tracks what happened to each entry during an import.
+// Excluded counts the networks whose data was removed by exclusions.
+type importAccounting struct {
+	Counts   importCounts    `json:"counts"`
+	Layers   []layerStats    `json:"layers"`
+	Excluded int             `json:"excluded"`
+	Rejected []rejectedEntry `json:"rejected"`
+}
+
+// reject records that entry was not written for the given reason and prints
+// a warning. written lists the prefixes of a partial insert.
+func (a *importAccounting) reject(entry importEntry, reason string, err error, written []string) {
+	switch reason {
+	case reasonInvalid:
+		a.Counts.SkippedInvalid++
+	case reasonReserved:
+		a.Counts.SkippedReserved++
+	case reasonPartial:
+		a.Counts.PartialInsert++
+	default:
+		a.Counts.InsertFailed++
+	}
+	a.Rejected = append(a.Rejected, rejectedEntry{
+		Source:   entry.Source,
+		Key:      entry.Key,
+		Position: entry.Index + 1,
+		Reason:   reason,
+		Error:    err.Error(),
+		Written:  written,
+	})
+	fmt.Fprintf(os.Stderr, "warn: %s: %s: %v\n", reason, entry.Key, err)
+}
+
+// summary returns a one-line description of the counts.
+func (a *importAccounting) summary() string {
+	c := a.Counts
+	return fmt.Sprintf("inserted: %d (merged: %d) | skipped invalid: %d | skipped reserved: %d | skipped null: %d | insert failed: %d | partial: %d",
+		c.Inserted, c.Merged, c.SkippedInvalid, c.SkippedReserved, c.SkippedNull, c.InsertFailed, c.PartialInsert)
+}
+
+// writeReport writes the accounting as JSON to path, with the rejected
+// entries in input order: by layer, then by position.
+func (a *importAccounting) writeReport(path string) error {
+	report := *a
+	layer := make(map[string]int, len(a.Layers))
+	for i := len(a.Layers) - 1; i >= 0; i-- {
+		layer[a.Layers[i].Source] = i
+	}
+	report.Rejected = append([]rejectedEntry{}, a.Rejected...)
+	sort.SliceStable(report.Rejected, func(i, j int) bool {
+		ri, rj := report.Rejected[i], report.Rejected[j]
+		if ri.Source != rj.Source {
+			return layer[ri.Source] < layer[rj.Source]
+		}
+		return ri.Position < rj.Position
+	})
+	out, err := json.MarshalIndent(report, "", "  ")
+	if err != nil {
+		return err
+	}
+	if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+		return err
+	}
+	return os.WriteFile(path, out, 0644)
+}
+
+// insertResult is the outcome of inserting a single entry.
+type insertResult struct {
+	// Reason is the rejection reason of the first network that failed, or
+	// reasonPartial if other networks were written.
+	Reason string
+	// Overlapped is set when the entry overlapped data already in the tree.
+	Overlapped bool
+	// Networks is the number of CIDR blocks that were written.
+	Networks int
+	// Written lists the CIDR blocks that were written.
+	Written []string
+}
+
+// insertEntry inserts every prefix of entry into tree using the given merge
+// strategy. It returns the error of the first prefix that failed; the other
+// prefixes are still inserted, and listed in Written, so a failure leaves
+// no prefix of the range behind that the report does not mention.
+func insertEntry(
+	tree *mmdbwriter.Tree,
+	entry importEntry,
+	record mmdbtype.DataType,
+	mergeStrategy inserter.FuncGenerator,
+) (insertResult, error) {
+	var res insertResult
+	fn := mergeStrategy(record)
+	tracked := func(existing mmdbtype.DataType) (mmdbtype.DataType, error) {
+		if existing != nil {
+			res.Overlapped = true
+		}
+		return fn(existing)
+	}
+
+	var err error
+	for _, network := range rangeIPNets(entry.Range) {
+		insertErr := tree.InsertFunc(network, tracked)
+		if insertErr == nil {
+			res.Networks++
+			res.Written = append(res.Written, network.String())
+			continue
+		}
+		if err != nil {
+			continue
+		}
+		err = insertErr
+		res.Reason = reasonFailed
+		var reservedErr *mmdbwriter.ReservedNetworkError
+		if errors.As(insertErr, &reservedErr) {
+			res.Reason = reasonReserved
+		}
+	}
+	if err != nil && res.Networks > 0 {
+		res.Reason = reasonPartial
+	}
+	return res, err
+}
@@ -0,0 +1,96 @@
+package cmd
+
+import (
+	"bytes"
+	"fmt"
+	"os"
+
+	"github.com/maxmind/mmdbwriter/mmdbtype"
+	"github.com/oschwald/maxminddb-golang"
+)
+
+// metadataStartMarker starts the metadata section at the end of an MMDB
+// file.
+var metadataStartMarker = []byte("\xAB\xCD\xEFMaxMind.com")
+
+// metadataMaxSize is how far from the end of a file readers look for the
+// metadata section.
+const metadataMaxSize = 128 * 1024
+
+// metadataBuffer encodes MMDB values without pointers.
+type metadataBuffer struct {
+	bytes.Buffer
+}
+
+// WriteOrWritePointer writes v in full; metadata is small enough not to need
+// pointers.
+func (b *metadataBuffer) WriteOrWritePointer(v mmdbtype.DataType) (int64, error) {
+	return v.WriteTo(b)
+}
+
+// clearBuildEpoch sets the build epoch of the MMDB file at path to 0. The
+// writer treats a build epoch of 0 as unset and writes the current time, so
+// an explicit 0 is written by replacing the metadata section.
+func clearBuildEpoch(path string) error {
+	db, err := maxminddb.Open(path)
+	if err != nil {
+		return err
+	}
+	meta := db.Metadata
+	db.Close()
+
+	description := mmdbtype.Map{}
+	for lang, text := range meta.Description {
+		description[mmdbtype.String(lang)] = mmdbtype.String(text)
+	}
+	languages := mmdbtype.Slice{}
+	for _, lang := range meta.Languages {
+		languages = append(languages, mmdbtype.String(lang))
+	}
+	metadata := mmdbtype.Map{
+		"binary_format_major_version": mmdbtype.Uint16(meta.BinaryFormatMajorVersion),
+		"binary_format_minor_version": mmdbtype.Uint16(meta.BinaryFormatMinorVersion),
+		"build_epoch":                 mmdbtype.Uint64(0),
+		"database_type":               mmdbtype.String(meta.DatabaseType),
+		"description":                 description,
+		"ip_version":                  mmdbtype.Uint16(meta.IPVersion),
+		"languages":                   languages,
+		"node_count":                  mmdbtype.Uint32(meta.NodeCount),
+		"record_size":                 mmdbtype.Uint16(meta.RecordSize),
+	}
+	var encoded metadataBuffer
+	if _, err := metadata.WriteTo(&encoded); err != nil {
+		return err
+	}
+
+	f, err := os.OpenFile(path, os.O_RDWR, 0)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+	info, err := f.Stat()
+	if err != nil {
+		return err
+	}
+	// The metadata section is at most 128 KiB, as readers only search there
+	tail := info.Size() - metadataMaxSize
+	if tail < 0 {
+		tail = 0
+	}
+	buf := make([]byte, info.Size()-tail)
+	if _, err := f.ReadAt(buf, tail); err != nil {
+		return err
+	}
+	start := bytes.LastIndex(buf, metadataStartMarker)
+	if start < 0 {
+		return fmt.Errorf("no metadata found in %s", path)
+	}
+	end := tail + int64(start+len(metadataStartMarker))
+	if err := f.Truncate(end); err != nil {
+		return err
+	}
+	if _, err := f.WriteAt(encoded.Bytes(), end); err != nil {
+		return err
+	}
+	return f.Close()
+}
@@ -1,11 +1,9 @@
 package cmd
 
 import (
-	"encoding/json"
 	"fmt"
-	"log"
 	"os"
-	"reflect"
+	"path/filepath"
 
 	"github.com/oschwald/maxminddb-golang"
 	"github.com/spf13/cobra"
@@ -16,6 +14,30 @@ var (
 	newPath string
 	summary bool
 	jsonOut bool
+	byRange bool
+
+	ndjsonOut  bool
+	patchOut   string
+	diffFields []string
+	diffIgnore []string
+	groupBy    string
+	diffTop    int
+	diffScopes []string
+
+	detectMoves    bool
+	moveSimilarity float64
+
+	againstPath    string
+	againstFormat  string
+	diffNullMode   string
+	diffListRecord string
+	diffOverlap    string
+
+	diffReportPath string
+
+	maxChangedPct   float64
+	maxRemoved      int
+	maxFieldChanges []string
 )
 
 var diffCmd = &cobra.Command{
@@ -25,17 +47,209 @@ var diffCmd = &cobra.Command{
 Example:
   mmdb diff --old old.mmdb --new new.mmdb
   mmdb diff --old old.mmdb --new new.mmdb --summary
-  mmdb diff --old old.mmdb --new new.mmdb --json`,
+  mmdb diff --old old.mmdb --new new.mmdb --json
+  mmdb diff --old old.mmdb --new new.mmdb --by-range
+  mmdb diff --old old.mmdb --new new.mmdb --ignore location.accuracy_radius
+  mmdb diff --old old.mmdb --new new.mmdb --group-by country.iso_code --top 10
+  mmdb diff --old old.mmdb --new new.mmdb --range 1.0.0.0/8,2001:db8::/32
+  mmdb diff --old old.mmdb --new new.mmdb --detect-moves --move-similarity 0.8
+  mmdb diff --against source.json --new built.mmdb
+  mmdb diff --old old.mmdb --new new.mmdb --by-range --report changes.html
+
+The metadata of both databases is compared first: database type,
+languages, descriptions, record size, IP version, node count, build epoch
+and binary format version. Differences are listed as changes to a
+"metadata" entry, so a rebuild with a different record size or languages
+is not reported as unchanged.
+
+--range limits the comparison to the given networks, in any key format
+accepted by import. Networks that contain a whole --range network are
+clipped to it, and percentages for --max-changed-pct are relative to the
+addresses in range.
+
+Modified networks are listed with the fields that changed, in the style of
+a JSON Patch: "add", "remove" or "replace", the dot-separated field path and
+the old and new values. Maps are compared field by field and arrays as a
+whole. --fields limits the comparison to the given paths and --ignore
+excludes paths from it, so a network whose only changes are in ignored
+fields is not reported as modified.
+
+By default networks are compared by their exact CIDR, so a /23 that is split
+into two /24s shows up as removed and added even if the data is unchanged.
+--by-range instead walks both databases over the same address space and
+reports the address ranges whose effective record differs, with the number
+of addresses affected. Renumbering and re-aggregation of networks without a
+change of data produce no output in this mode. IPv4 networks are compared
+in the IPv4 part (::/96) of the address space, so an IPv4 and an IPv6
+database can be compared as well.
+
+Both databases are read as a merge over their networks in address order,
+so memory use does not grow with their size. Changes are printed in address
+order as they are found, marked "+" (added), "-" (removed) or "~"
+(modified), followed by the counts. --ndjson streams one JSON object per
+change; --json groups the changes by kind and is written at the end.
+
+--patch-out writes the changes as a patch for the "patch" command, which
+turns the old database into the new one: removed networks become
+remove-network, added networks set, and modified fields set-field or
+delete-field operations, with the exact MMDB type of every number.
+Changed metadata (build epoch, database type, description, IP version,
+languages and record size) goes into the metadata section of the patch.
+The patch records the SHA-256 of the old database so it is never applied
+to another one. With --by-range the patch works on ranges and is usually
+smaller.
+
+  mmdb diff --old old.mmdb --new new.mmdb --patch-out changes.json
+  mmdb patch --db old.mmdb --patch changes.json --out new.mmdb
+
+--detect-moves matches removed networks with added networks that have the
+same record and reports each pair as a move, marked ">" with the old and the
+new network, instead of an unrelated removal and addition. With
+--move-similarity below 1, records also match if at least that share of
+their fields is equal, and the differing fields are listed as for a
+modified network. Added and removed networks are held until the end, so
+they are printed after the modified ones and memory use grows with their
+number. Moves are not counted as removed for --max-removed.
+
+SOURCE FILES
+
+--against compares --new with the import source it was built from, to
+check that overlapping keys, reserved networks, exclusions or failed
+inserts did not change what the database contains. An --old file ending in
+.json, .ndjson, .jsonl, .csv, .txt, .list or .lst is taken as --against.
+The source is read as import reads it, with --format, --record and
+--null, and overlapping keys are resolved by --overlap as in import with
+the default --merge none: each key is only checked at the addresses it
+wins. For every key that does not carry its record at all of those
+addresses in the database a change is reported:
+
+  - key       no address of the key has data in the database
+  ~ key       some addresses have a different record or none; the fields
+              of the first differing record are listed, and "remove
+              (record)" if addresses have no data
+  + network   data in the database outside all keys
+
+Keys are reported as written in the source, with the number of addresses
+affected, in address order. Metadata, --by-range, --detect-moves,
+--patch-out and --range do not apply to a source file.
+
+  mmdb diff --against source.csv --new built.mmdb --summary \
+    --max-changed-pct 0
+
+--group-by replaces the list of changes with a transition matrix for one
+field path: for every pair of old and new values, the number of addresses
+and networks that moved from one to the other, largest first. Added
+networks move from "(none)" and removed networks to it; modified networks
+count only if the value of the field changed. A second table sums, for
+every value, the addresses and networks it gained and lost. --top limits
+both tables to their largest rows and --json prints them as JSON. With
+--by-range, networks are counted as ranges.
+
+REPORTS
+
+--report writes a report for release notes, as a single self-contained
+HTML file (.html) or as Markdown (.md), in addition to the normal output.
+It contains the number of changes of each kind with the addresses affected
+per family, the metadata changes, the fields that changed in the most
+networks, the value transitions of the --group-by field and up to 10
+samples of each kind of change.
+
+THRESHOLDS
+
+For use before publishing a build, diff can check the changes against
+limits and exit with status 3 if any is exceeded, after printing the diff
+and, on stderr, every limit that was exceeded:
+
+  --max-changed-pct 5
+      at most 5% of the IPv4 and 5% of the IPv6 addresses of the old
+      database added, removed or modified
+  --max-removed 100
+      at most 100 networks removed
+  --max-field-change country.iso_code=1%
+      the field differs for at most 1% of the IPv4 and of the IPv6
+      addresses
+  --max-field-change asn=500
+      the field differs in at most 500 networks
+
+Percentages are checked for IPv4 and IPv6 separately, and the failing
+family is named, so that a large IPv6 database cannot hide the loss of its
+IPv4 data. A change to a family the old database has no addresses in
+counts as 100% of it.
+
+Without --by-range a network that is split or merged counts as removed and
+added, so the changed percentage can exceed what really changed; use
+--by-range for exact address counts. Status 1 still means that diff could
+not run.
+
+  mmdb diff --old yesterday.mmdb --new today.mmdb --by-range --summary \
+    --max-changed-pct 5 --max-field-change country.iso_code=1%`,
 	RunE: func(cmd *cobra.Command, args []string) error {
-		if oldPath == "" || newPath == "" {
+		sourcePath := againstPath
+		if sourcePath == "" {
+			if _, ok := sourceFormatFor(oldPath); ok {
+				sourcePath = oldPath
+			}
+		}
+		if (oldPath == "" && sourcePath == "") || newPath == "" {
 			return fmt.Errorf("both --old and --new flags are required")
 		}
+		if jsonOut && ndjsonOut {
+			return fmt.Errorf("--json and --ndjson cannot be used together")
+		}
+		if patchOut != "" && (len(diffFields) > 0 || len(diffIgnore) > 0) {
+			return fmt.Errorf("--patch-out cannot be used with --fields or --ignore")
+		}
+		if groupBy != "" && (summary || ndjsonOut) {
+			return fmt.Errorf("--group-by cannot be used with --summary or --ndjson")
+		}
+		if groupBy != "" && !filterKeepsPath(diffFields, diffIgnore, groupBy) {
+			return fmt.Errorf("--group-by %s is excluded from the comparison by --fields or --ignore", groupBy)
+		}
+		if sourcePath != "" && (byRange || detectMoves || patchOut != "" || len(diffScopes) > 0) {
+			return fmt.Errorf("a source file cannot be compared with --by-range, --detect-moves, --patch-out or --range")
+		}
+
+		if diffReportPath != "" {
+			if err := checkReportPath(diffReportPath); err != nil {
+				return err
+			}
+		}
+		if moveSimilarity <= 0 || moveSimilarity > 1 {
+			return fmt.Errorf("--move-similarity must be greater than 0 and at most 1")
+		}
+		if diffNullMode != nullOmit && diffNullMode != nullEmpty && diffNullMode != nullError {
+			return fmt.Errorf("--null must be one of: omit, empty, error")
+		}
+		if diffOverlap != overlapSpecific && diffOverlap != overlapFile && diffOverlap != overlapError {
+			return fmt.Errorf("--overlap must be one of: specific, file, error")
+		}
 
-		oldDB, err := maxminddb.Open(oldPath)
+		sourceFormat := againstFormat
+		if sourcePath != "" && sourceFormat == "" {
+			sourceFormat, _ = sourceFormatFor(sourcePath)
+			if sourceFormat == "" {
+				sourceFormat = formatJSON
+			}
+		}
+
+		thresholds, err := thresholdsFromFlags(cmd)
+		if err != nil {
+			return err
+		}
+
+		scopes, err := parseScopes(diffScopes)
 		if err != nil {
-			return fmt.Errorf("failed to open old db: %v", err)
+			return err
+		}
+
+		var oldDB *maxminddb.Reader
+		if sourcePath == "" {
+			oldDB, err = maxminddb.Open(oldPath)
+			if err != nil {
+				return fmt.Errorf("failed to open old db: %v", err)
+			}
+			defer oldDB.Close()
 		}
-		defer oldDB.Close()
 
 		newDB, err := maxminddb.Open(newPath)
 		if err != nil {
@@ -43,107 +257,245 @@ Example:
 		}
 		defer newDB.Close()
 
-		oldData := make(map[string]interface{})
-		newData := make(map[string]interface{})
+		format := diffFormatText
+		switch {
+		case summary:
+			format = diffFormatSummary
+		case jsonOut:
+			format = diffFormatJSON
+		case ndjsonOut:
+			format = diffFormatNDJSON
+		}
+		// Source keys are ranges, so their address counts are shown too.
+		printer := newDiffPrinter(os.Stdout, format, byRange || sourcePath != "")
+		filter := recordFilter{Fields: diffFields, Ignore: diffIgnore}
 
-		// --- Read old database ---
-		oldIter := oldDB.Networks()
-		for oldIter.Next() {
-			var record map[string]interface{}
-			network, err := oldIter.Network(&record)
-			if err == nil {
-				oldData[network.String()] = record
-			}
+		var metadata []fieldChange
+		if oldDB != nil {
+			metadata = diffMetadata(oldDB.Metadata, newDB.Metadata)
 		}
-		if err := oldIter.Err(); err != nil {
-			log.Printf("warning: error reading old db: %v\n", err)
+		var matrix *transitionMatrix
+		if groupBy != "" {
+			matrix = newTransitionMatrix(groupBy)
+			matrix.metadata = metadata
+		} else if err := printer.addMetadata(metadata); err != nil {
+			return err
 		}
-
-		// --- Read new database ---
-		newIter := newDB.Networks()
-		for newIter.Next() {
-			var record map[string]interface{}
-			network, err := newIter.Network(&record)
-			if err == nil {
-				newData[network.String()] = record
+		var summaryReport *diffReport
+		if diffReportPath != "" {
+			oldName := oldPath
+			if sourcePath != "" {
+				oldName = sourcePath
+			}
+			summaryReport = newDiffReport(filepath.Base(oldName), filepath.Base(newPath))
+			summaryReport.metadata = metadata
+			if detectMoves {
+				summaryReport.addKind(changeMoved)
 			}
 		}
-		if err := newIter.Err(); err != nil {
-			log.Printf("warning: error reading new db: %v\n", err)
+		report := func(c diffChange, oldRec, newRec interface{}) error {
+			thresholds.add(c, oldRec, newRec)
+			if summaryReport != nil {
+				summaryReport.add(c)
+			}
+			if matrix != nil {
+				matrix.add(c.Kind, oldRec, newRec, c.Addresses)
+				return nil
+			}
+			return printer.add(c)
 		}
 
-		// --- Compare ---
-		added := make(map[string]interface{})
-		removed := make(map[string]interface{})
-		modified := make(map[string]interface{})
+		var total familyCounts
+		var patch *diffPatch
+		if sourcePath != "" {
+			total, err = diffSource(sourcePath, sourceFormat, diffListRecord, diffOverlap, newDB, filter, diffNullMode, report)
+			if err != nil {
+				return fmt.Errorf("failed to compare %s: %v", sourcePath, err)
+			}
+		} else {
+			oldNets := newNetworkStream(oldDB, filter, scopes)
+			newNets := newNetworkStream(newDB, filter, scopes)
 
-		for netStr, oldVal := range oldData {
-			newVal, exists := newData[netStr]
-			if !exists {
-				removed[netStr] = oldVal
-			} else if !reflect.DeepEqual(oldVal, newVal) {
-				modified[netStr] = map[string]interface{}{
-					"old": oldVal,
-					"new": newVal,
+			if patchOut != "" {
+				base, _, err := hashFile(oldPath)
+				if err != nil {
+					return fmt.Errorf("failed to hash old db: %v", err)
 				}
+				patch = &diffPatch{base: base}
+				patch.setMetadata(oldDB.Metadata, newDB.Metadata)
+				newNets.decodeTypes()
 			}
-		}
 
-		for netStr, newVal := range newData {
-			if _, exists := oldData[netStr]; !exists {
-				added[netStr] = newVal
+			var moves *moveDetector
+			if detectMoves {
+				moves = newMoveDetector(moveSimilarity)
+				printer.detectMoves()
 			}
-		}
 
-		// --- Output ---
-		if summary {
-			fmt.Printf("Added: %d | Removed: %d | Modified: %d\n",
-				len(added), len(removed), len(modified))
-			return nil
+			if byRange {
+				err = diffByRange(oldNets, newNets, func(c rangeChange) error {
+					change := newRangeChange(c)
+					if patch != nil {
+						patch.add(c.Kind, change.Network, c.Old, c.New, c.NewTyped)
+					}
+					if moves != nil && c.Kind == changeRemoved {
+						moves.hold(change, c.Range, c.Old)
+						return nil
+					}
+					if moves != nil && c.Kind == changeAdded {
+						moves.hold(change, c.Range, c.New)
+						return nil
+					}
+					return report(change, c.Old, c.New)
+				})
+			} else {
+				err = diffNetworks(oldNets, newNets, func(kind string, o, n diffNetwork) error {
+					change := newNetworkChange(kind, o, n)
+					if patch != nil {
+						patch.add(kind, change.Network, o.Record, n.Record, n.Typed)
+					}
+					if moves != nil && kind == changeRemoved {
+						moves.hold(change, o.Range, o.Record)
+						return nil
+					}
+					if moves != nil && kind == changeAdded {
+						moves.hold(change, n.Range, n.Record)
+						return nil
+					}
+					return report(change, o.Record, n.Record)
+				})
+			}
+			if err != nil {
+				return fmt.Errorf("failed to compare databases: %v", err)
+			}
+			if moves != nil {
+				if err := moves.flush(report); err != nil {
+					return err
+				}
+			}
+			total = oldNets.addresses
 		}
 
-		output := map[string]interface{}{
-			"added":    added,
-			"removed":  removed,
-			"modified": modified,
+		if matrix != nil {
+			if err := matrix.write(os.Stdout, jsonOut, diffTop); err != nil {
+				return err
+			}
+		} else if err := printer.finish(); err != nil {
+			return err
 		}
 
-		if jsonOut {
-			enc := json.NewEncoder(os.Stdout)
-			enc.SetIndent("", "  ")
-			return enc.Encode(output)
+		if summaryReport != nil {
+			if err := summaryReport.write(diffReportPath, matrix, diffTop); err != nil {
+				return fmt.Errorf("failed to write report: %v", err)
+			}
+			fmt.Fprintf(os.Stderr, "✅ Wrote report to %s\n", diffReportPath)
 		}
 
-		fmt.Printf("Added: %d\nRemoved: %d\nModified: %d\n\n",
-			len(added), len(removed), len(modified))
-
-		if len(added) > 0 {
-			fmt.Println("Added:")
-			for n := range added {
-				fmt.Println("  ", n)
+		if patch != nil {
+			if err := patch.write(patchOut); err != nil {
+				return fmt.Errorf("failed to write patch: %v", err)
 			}
+			fmt.Fprintf(os.Stderr, "✅ Wrote %d patch operations to %s\n", patch.size(), patchOut)
 		}
-		if len(removed) > 0 {
-			fmt.Println("Removed:")
-			for n := range removed {
-				fmt.Println("  ", n)
+
+		if thresholds.active() {
+			exceeded := thresholds.check(total)
+			for _, e := range exceeded {
+				fmt.Fprintf(os.Stderr, "❌ Threshold exceeded: %s\n", e)
 			}
-		}
-		if len(modified) > 0 {
-			fmt.Println("Modified:")
-			for n := range modified {
-				fmt.Println("  ", n)
+			if len(exceeded) > 0 {
+				os.Exit(exitThresholdExceeded)
 			}
+			fmt.Fprintln(os.Stderr, "✅ All thresholds passed")
 		}
-
 		return nil
 	},
 }
 
+// thresholdsFromFlags returns the thresholds set on the command line.
+func thresholdsFromFlags(cmd *cobra.Command) (*diffThresholds, error) {
+	var pct *float64
+	if cmd.Flags().Changed("max-changed-pct") {
+		if maxChangedPct < 0 {
+			return nil, fmt.Errorf("--max-changed-pct must not be negative")
+		}
+		pct = &maxChangedPct
+	}
+	var removed *int
+	if cmd.Flags().Changed("max-removed") {
+		if maxRemoved < 0 {
+			return nil, fmt.Errorf("--max-removed must not be negative")
+		}
+		removed = &maxRemoved
+	}
+	var fields []*fieldThreshold
+	for _, spec := range maxFieldChanges {
+		f, err := parseFieldThreshold(spec)
+		if err != nil {
+			return nil, err
+		}
+		if !filterKeepsPath(diffFields, diffIgnore, f.Path) {
+			return nil, fmt.Errorf("--max-field-change %s is excluded from the comparison by --fields or --ignore", f.Path)
+		}
+		fields = append(fields, f)
+	}
+	return newDiffThresholds(pct, removed, fields), nil
+}
+
+// newNetworkChange describes a network that was added, removed or modified.
+func newNetworkChange(kind string, o, n diffNetwork) diffChange {
+	switch kind {
+	case changeAdded:
+		return diffChange{Kind: kind, Network: n.Network.String(), Addresses: rangeSize(n.Range), Record: n.Record}
+	case changeRemoved:
+		return diffChange{Kind: kind, Network: o.Network.String(), Addresses: rangeSize(o.Range), Record: o.Record}
+	default:
+		return diffChange{
+			Kind:      kind,
+			Network:   n.Network.String(),
+			Addresses: rangeSize(n.Range),
+			Changes:   diffRecords("", o.Record, n.Record),
+		}
+	}
+}
+
+// newRangeChange describes a range whose effective record differs.
+func newRangeChange(c rangeChange) diffChange {
+	out := diffChange{Kind: c.Kind, Network: formatRange(treeToRange(c.Range)), Addresses: rangeSize(c.Range)}
+	switch c.Kind {
+	case changeAdded:
+		out.Record = c.New
+	case changeRemoved:
+		out.Record = c.Old
+	default:
+		out.Changes = diffRecords("", c.Old, c.New)
+	}
+	return out
+}
+
 func init() {
 	rootCmd.AddCommand(diffCmd)
 	diffCmd.Flags().StringVar(&oldPath, "old", "", "Path to the old MMDB file")
 	diffCmd.Flags().StringVar(&newPath, "new", "", "Path to the new MMDB file")
+	diffCmd.Flags().StringVar(&againstPath, "against", "", "Import source (JSON, NDJSON, CSV or list) to compare --new against instead of --old")
+	diffCmd.Flags().StringVar(&againstFormat, "format", "", "Format of the --against source: json, ndjson, list, csv (default: from the file extension)")
+	diffCmd.Flags().StringVar(&diffNullMode, "null", nullEmpty, "Handling of JSON null values in the --against source, as in import: omit, empty, error")
+	diffCmd.Flags().StringVar(&diffListRecord, "record", defaultListRecord, "JSON record of a list --against source, as in import")
+	diffCmd.Flags().StringVar(&diffOverlap, "overlap", overlapSpecific, "Precedence for overlapping keys of the --against source, as in import: specific, file, error")
 	diffCmd.Flags().BoolVar(&summary, "summary", false, "Show only summary counts")
 	diffCmd.Flags().BoolVar(&jsonOut, "json", false, "Output the result as JSON")
+	diffCmd.Flags().StringVar(&patchOut, "patch-out", "", "Write the changes as a patch that turns --old into --new")
+	diffCmd.Flags().BoolVar(&ndjsonOut, "ndjson", false, "Stream the changes as newline-delimited JSON")
+	diffCmd.Flags().StringSliceVar(&diffFields, "fields", nil, "Comma-separated field paths to compare (e.g. country.iso_code,location)")
+	diffCmd.Flags().StringSliceVar(&diffIgnore, "ignore", nil, "Comma-separated field paths to leave out of the comparison")
+	diffCmd.Flags().StringVar(&diffReportPath, "report", "", "Write a human-readable report to this .html or .md file")
+	diffCmd.Flags().BoolVar(&detectMoves, "detect-moves", false, "Report removed and added networks with the same record as moves")
+	diffCmd.Flags().Float64Var(&moveSimilarity, "move-similarity", 1, "With --detect-moves, the share of fields (0-1] two records must have in common to count as a move")
+	diffCmd.Flags().StringVar(&groupBy, "group-by", "", "Report how the values of a field path moved (e.g. country.iso_code)")
+	diffCmd.Flags().IntVar(&diffTop, "top", 0, "With --group-by, show only the N largest rows (0 for all)")
+	diffCmd.Flags().StringSliceVar(&diffScopes, "range", nil, "Comma-separated networks to limit the comparison to (e.g. 1.0.0.0/8,2001:db8::/32)")
+	diffCmd.Flags().Float64Var(&maxChangedPct, "max-changed-pct", 0, "Exit with status 3 if more than this percentage of addresses changed")
+	diffCmd.Flags().IntVar(&maxRemoved, "max-removed", 0, "Exit with status 3 if more than this many networks were removed")
+	diffCmd.Flags().StringArrayVar(&maxFieldChanges, "max-field-change", nil, "Exit with status 3 if a field changed in more than N networks or N% of addresses (path=N or path=N%, repeatable)")
+	diffCmd.Flags().BoolVar(&byRange, "by-range", false, "Compare the effective record of every address instead of exact networks")
 }
@@ -0,0 +1,161 @@
+package cmd
+
+import (
+	"encoding/json"
+	"fmt"
+	"reflect"
+	"sort"
+	"strings"
+)
+
+// Field change operations, named after their JSON Patch equivalents.
+const (
+	fieldAdd     = "add"
+	fieldRemove  = "remove"
+	fieldReplace = "replace"
+)
+
+// fieldChange is a change to one field of a record. Path is a dot-separated
+// field path, or "" for a record that is not a map.
+type fieldChange struct {
+	Op   string      `json:"op"`
+	Path string      `json:"path"`
+	Old  interface{} `json:"old,omitempty"`
+	New  interface{} `json:"new,omitempty"`
+}
+
+// diffRecords returns the field-level changes from old to new. Maps are
+// compared key by key; any other value, including arrays, is compared as a
+// whole.
+func diffRecords(path string, old, new interface{}) []fieldChange {
+	oldMap, ok1 := old.(map[string]interface{})
+	newMap, ok2 := new.(map[string]interface{})
+	if !ok1 || !ok2 {
+		if reflect.DeepEqual(old, new) {
+			return nil
+		}
+		return []fieldChange{{Op: fieldReplace, Path: path, Old: old, New: new}}
+	}
+
+	keys := make([]string, 0, len(oldMap)+len(newMap))
+	for k := range oldMap {
+		keys = append(keys, k)
+	}
+	for k := range newMap {
+		if _, ok := oldMap[k]; !ok {
+			keys = append(keys, k)
+		}
+	}
+	sort.Strings(keys)
+
+	var changes []fieldChange
+	for _, k := range keys {
+		childPath := k
+		if path != "" {
+			childPath = path + "." + k
+		}
+		oldVal, inOld := oldMap[k]
+		newVal, inNew := newMap[k]
+		switch {
+		case !inOld:
+			changes = append(changes, fieldChange{Op: fieldAdd, Path: childPath, New: newVal})
+		case !inNew:
+			changes = append(changes, fieldChange{Op: fieldRemove, Path: childPath, Old: oldVal})
+		default:
+			changes = append(changes, diffRecords(childPath, oldVal, newVal)...)
+		}
+	}
+	return changes
+}
+
+// formatFieldChange prints a change on one line, with values as JSON.
+func formatFieldChange(c fieldChange) string {
+	path := c.Path
+	if path == "" {
+		path = "(record)"
+	}
+	switch c.Op {
+	case fieldAdd:
+		return fmt.Sprintf("add %s: %s", path, compactJSON(c.New))
+	case fieldRemove:
+		return fmt.Sprintf("remove %s: %s", path, compactJSON(c.Old))
+	default:
+		return fmt.Sprintf("replace %s: %s -> %s", path, compactJSON(c.Old), compactJSON(c.New))
+	}
+}
+
+// compactJSON returns v as single-line JSON.
+func compactJSON(v interface{}) string {
+	out, err := json.Marshal(v)
+	if err != nil {
+		return fmt.Sprint(v)
+	}
+	return string(out)
+}
+
+// recordFilter limits the fields that diff compares. With Fields set, only
+// those paths are kept; paths in Ignore are always removed.
+type recordFilter struct {
+	Fields []string
+	Ignore []string
+}
+
+// apply returns the part of record that is compared. It may modify record.
+func (f recordFilter) apply(record interface{}) interface{} {
+	if len(f.Fields) > 0 {
+		selected := map[string]interface{}{}
+		for _, path := range f.Fields {
+			if val, ok := extractField(record, path); ok {
+				setFieldPath(selected, strings.Split(path, "."), val)
+			}
+		}
+		record = selected
+	}
+	for _, path := range f.Ignore {
+		removeFieldPath(record, strings.Split(path, "."))
+	}
+	return record
+}
+
+// filterKeepsPath reports whether the field path survives a recordFilter
+// with the given fields and ignored paths.
+func filterKeepsPath(fields, ignore []string, path string) bool {
+	kept := len(fields) == 0
+	for _, f := range fields {
+		if path == f || strings.HasPrefix(path, f+".") {
+			kept = true
+		}
+	}
+	for _, i := range ignore {
+		if path == i || strings.HasPrefix(path, i+".") {
+			kept = false
+		}
+	}
+	return kept
+}
+
+// setFieldPath stores val at keys in m, creating intermediate maps.
+func setFieldPath(m map[string]interface{}, keys []string, val interface{}) {
+	for _, k := range keys[:len(keys)-1] {
+		child, ok := m[k].(map[string]interface{})
+		if !ok {
+			child = map[string]interface{}{}
+			m[k] = child
+		}
+		m = child
+	}
+	m[keys[len(keys)-1]] = val
+}
+
+// removeFieldPath deletes the value at keys from v, if present.
+func removeFieldPath(v interface{}, keys []string) {
+	m, ok := v.(map[string]interface{})
+	if !ok {
+		return
+	}
+	if len(keys) == 1 {
+		delete(m, keys[0])
+		return
+	}
+	removeFieldPath(m[keys[0]], keys[1:])
+}
@@ -0,0 +1,45 @@
+package cmd
+
+import (
+	"fmt"
+	"io"
+
+	"github.com/oschwald/maxminddb-golang"
+)
+
+// diffMetadata returns the metadata fields that differ between two
+// databases, with the field names used in the MMDB metadata section.
+func diffMetadata(old, new maxminddb.Metadata) []fieldChange {
+	return diffRecords("", metadataFields(old), metadataFields(new))
+}
+
+// metadataFields returns the compared metadata fields of m.
+func metadataFields(m maxminddb.Metadata) map[string]interface{} {
+	description := map[string]interface{}{}
+	for lang, text := range m.Description {
+		description[lang] = text
+	}
+	return map[string]interface{}{
+		"binary_format_major_version": m.BinaryFormatMajorVersion,
+		"binary_format_minor_version": m.BinaryFormatMinorVersion,
+		"build_epoch":                 m.BuildEpoch,
+		"database_type":               m.DatabaseType,
+		"description":                 description,
+		"ip_version":                  m.IPVersion,
+		"languages":                   append([]string{}, m.Languages...),
+		"node_count":                  m.NodeCount,
+		"record_size":                 m.RecordSize,
+	}
+}
+
+// printMetadataChanges prints metadata changes in the style of a modified
+// network.
+func printMetadataChanges(w io.Writer, changes []fieldChange) {
+	if len(changes) == 0 {
+		return
+	}
+	fmt.Fprintln(w, "~ metadata")
+	for _, fc := range changes {
+		fmt.Fprintf(w, "      %s\n", formatFieldChange(fc))
+	}
+}
@@ -0,0 +1,173 @@
+package cmd
+
+import (
+	"sort"
+	"strings"
+
+	"go4.org/netipx"
+)
+
+// changeMoved is the kind of a removed network whose record reappears in an
+// added network.
+const changeMoved = "moved"
+
+// heldChange is an added or removed network waiting to be matched.
+type heldChange struct {
+	change diffChange
+	record interface{}
+	key    string
+	rng    netipx.IPRange
+	used   bool
+}
+
+// moveDetector holds the added and removed networks of a diff and matches
+// them into moves: pairs whose records are identical or, with a similarity
+// below 1, share at least that fraction of their fields.
+type moveDetector struct {
+	similarity float64
+	removed    []*heldChange
+	added      []*heldChange
+}
+
+// newMoveDetector returns a detector with the given minimum similarity,
+// between 0 and 1.
+func newMoveDetector(similarity float64) *moveDetector {
+	return &moveDetector{similarity: similarity}
+}
+
+// hold keeps an added or removed network until flush. r is its range in
+// tree space and record the record it added or removed.
+func (d *moveDetector) hold(c diffChange, r netipx.IPRange, record interface{}) {
+	h := &heldChange{change: c, record: record, key: compactJSON(record), rng: r}
+	if c.Kind == changeRemoved {
+		d.removed = append(d.removed, h)
+	} else {
+		d.added = append(d.added, h)
+	}
+}
+
+// flush matches the held networks and reports the moves and the networks
+// that remain added or removed, in address order.
+func (d *moveDetector) flush(report func(c diffChange, oldRec, newRec interface{}) error) error {
+	type result struct {
+		change         diffChange
+		oldRec, newRec interface{}
+		rng            netipx.IPRange
+	}
+	var results []result
+
+	move := func(o, n *heldChange) {
+		o.used, n.used = true, true
+		results = append(results, result{
+			change: diffChange{
+				Kind:      changeMoved,
+				Network:   n.change.Network,
+				From:      o.change.Network,
+				Addresses: n.change.Addresses,
+				Changes:   diffRecords("", o.record, n.record),
+			},
+			oldRec: o.record,
+			newRec: n.record,
+			rng:    n.rng,
+		})
+	}
+
+	// Identical records first, pairing them in address order.
+	byKey := map[string][]*heldChange{}
+	for _, n := range d.added {
+		byKey[n.key] = append(byKey[n.key], n)
+	}
+	for _, o := range d.removed {
+		if candidates := byKey[o.key]; len(candidates) > 0 {
+			move(o, candidates[0])
+			byKey[o.key] = candidates[1:]
+		}
+	}
+
+	// Then the most similar remaining record, if similar enough.
+	if d.similarity < 1 {
+		leaves := map[*heldChange]map[string]string{}
+		for _, h := range append(append([]*heldChange{}, d.removed...), d.added...) {
+			if !h.used {
+				leaves[h] = recordLeaves(h.record)
+			}
+		}
+		for _, o := range d.removed {
+			if o.used {
+				continue
+			}
+			var best *heldChange
+			bestScore := d.similarity
+			for _, n := range d.added {
+				if n.used {
+					continue
+				}
+				if score := leafSimilarity(leaves[o], leaves[n]); score >= bestScore && (best == nil || score > bestScore) {
+					best, bestScore = n, score
+				}
+			}
+			if best != nil {
+				move(o, best)
+			}
+		}
+	}
+
+	for _, h := range append(append([]*heldChange{}, d.removed...), d.added...) {
+		if h.used {
+			continue
+		}
+		r := result{change: h.change, rng: h.rng}
+		if h.change.Kind == changeRemoved {
+			r.oldRec = h.record
+		} else {
+			r.newRec = h.record
+		}
+		results = append(results, r)
+	}
+
+	sort.SliceStable(results, func(i, j int) bool {
+		return rangeLess(results[i].rng, results[j].rng)
+	})
+	for _, r := range results {
+		if err := report(r.change, r.oldRec, r.newRec); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// recordLeaves flattens a record into its dot-separated field paths and
+// their values as JSON. Arrays are leaves, as in diffRecords.
+func recordLeaves(record interface{}) map[string]string {
+	leaves := map[string]string{}
+	var walk func(path string, v interface{})
+	walk = func(path string, v interface{}) {
+		m, ok := v.(map[string]interface{})
+		if !ok {
+			leaves[path] = compactJSON(v)
+			return
+		}
+		for k, child := range m {
+			walk(strings.TrimPrefix(path+"."+k, "."), child)
+		}
+	}
+	walk("", record)
+	return leaves
+}
+
+// leafSimilarity returns the share of fields that have the same value in a
+// and b, out of all fields present in either.
+func leafSimilarity(a, b map[string]string) float64 {
+	same, union := 0, len(a)
+	for path, v := range b {
+		if av, ok := a[path]; !ok {
+			union++
+		} else if av == v {
+			same++
+		}
+	}
+	if union == 0 {
+		return 1
+	}
+	return float64(same) / float64(union)
+}
@@ -0,0 +1,206 @@
+package cmd
+
+import (
+	"bufio"
+	"encoding/json"
+	"fmt"
+	"io"
+	"math/big"
+)
+
+// Output formats of the diff command.
+const (
+	diffFormatText    = "text"
+	diffFormatJSON    = "json"
+	diffFormatNDJSON  = "ndjson"
+	diffFormatSummary = "summary"
+)
+
+// diffChange is a single added, removed or modified network or range.
+type diffChange struct {
+	Kind      string        `json:"kind"`
+	Network   string        `json:"network"`
+	From      string        `json:"from,omitempty"`
+	Addresses *big.Int      `json:"addresses"`
+	Record    interface{}   `json:"record,omitempty"`
+	Changes   []fieldChange `json:"changes,omitempty"`
+}
+
+// diffStats counts the changes and the addresses they cover per kind.
+type diffStats struct {
+	Changes   map[string]int      `json:"changes"`
+	Addresses map[string]*big.Int `json:"addresses"`
+}
+
+// newDiffStats returns zeroed counts for every change kind.
+func newDiffStats() diffStats {
+	s := diffStats{Changes: map[string]int{}, Addresses: map[string]*big.Int{}}
+	for _, kind := range []string{changeAdded, changeRemoved, changeModified} {
+		s.Changes[kind] = 0
+		s.Addresses[kind] = new(big.Int)
+	}
+	return s
+}
+
+// add counts c.
+func (s diffStats) add(c diffChange) {
+	s.Changes[c.Kind]++
+	s.Addresses[c.Kind].Add(s.Addresses[c.Kind], c.Addresses)
+}
+
+// diffPrinter writes diff results. Text and NDJSON output are written as
+// changes are found; JSON output keeps the changes grouped by kind and is
+// written at the end.
+type diffPrinter struct {
+	format   string
+	byRange  bool
+	w        *bufio.Writer
+	stats    diffStats
+	grouped  map[string][]diffChange
+	metadata []fieldChange
+	moves    bool
+}
+
+// newDiffPrinter returns a printer writing to w in format.
+func newDiffPrinter(w io.Writer, format string, byRange bool) *diffPrinter {
+	return &diffPrinter{
+		format:  format,
+		byRange: byRange,
+		w:       bufio.NewWriter(w),
+		stats:   newDiffStats(),
+		grouped: map[string][]diffChange{
+			changeAdded:    {},
+			changeRemoved:  {},
+			changeModified: {},
+		},
+	}
+}
+
+// detectMoves makes the printer count and print moved networks.
+func (p *diffPrinter) detectMoves() {
+	p.moves = true
+	p.stats.Changes[changeMoved] = 0
+	p.stats.Addresses[changeMoved] = new(big.Int)
+	p.grouped[changeMoved] = []diffChange{}
+}
+
+// addMetadata records the metadata changes and, for streaming formats,
+// prints them. It is called before any network change.
+func (p *diffPrinter) addMetadata(changes []fieldChange) error {
+	p.metadata = changes
+	if len(changes) == 0 {
+		return nil
+	}
+
+	switch p.format {
+	case diffFormatNDJSON:
+		line, err := json.Marshal(map[string]interface{}{"kind": "metadata", "changes": changes})
+		if err != nil {
+			return err
+		}
+		p.w.Write(line)
+		p.w.WriteByte('\n')
+	case diffFormatText:
+		printMetadataChanges(p.w, changes)
+	}
+	return nil
+}
+
+// add records and, for streaming formats, prints c.
+func (p *diffPrinter) add(c diffChange) error {
+	p.stats.add(c)
+
+	switch p.format {
+	case diffFormatJSON:
+		p.grouped[c.Kind] = append(p.grouped[c.Kind], c)
+	case diffFormatNDJSON:
+		line, err := json.Marshal(c)
+		if err != nil {
+			return err
+		}
+		p.w.Write(line)
+		p.w.WriteByte('\n')
+	case diffFormatText:
+		marker := map[string]string{changeAdded: "+", changeRemoved: "-", changeModified: "~", changeMoved: ">"}[c.Kind]
+		if c.Kind == changeMoved {
+			fmt.Fprintf(p.w, "%s %s → %s", marker, c.From, c.Network)
+			if p.byRange {
+				fmt.Fprintf(p.w, " (%s addresses)", c.Addresses)
+			}
+			fmt.Fprintln(p.w)
+		} else if p.byRange {
+			fmt.Fprintf(p.w, "%s %s (%s addresses)\n", marker, c.Network, c.Addresses)
+		} else {
+			fmt.Fprintf(p.w, "%s %s\n", marker, c.Network)
+		}
+		for _, fc := range c.Changes {
+			fmt.Fprintf(p.w, "      %s\n", formatFieldChange(fc))
+		}
+	}
+	return nil
+}
+
+// finish prints the counts, or the grouped JSON document, and flushes the
+// output.
+func (p *diffPrinter) finish() error {
+	s := p.stats
+	switch p.format {
+	case diffFormatJSON:
+		enc := json.NewEncoder(p.w)
+		enc.SetIndent("", "  ")
+		metadata := p.metadata
+		if metadata == nil {
+			metadata = []fieldChange{}
+		}
+		doc := map[string]interface{}{
+			"metadata": metadata,
+			"stats":    s,
+			"added":    p.grouped[changeAdded],
+			"removed":  p.grouped[changeRemoved],
+			"modified": p.grouped[changeModified],
+		}
+		if p.moves {
+			doc["moved"] = p.grouped[changeMoved]
+		}
+		if err := enc.Encode(doc); err != nil {
+			return err
+		}
+	case diffFormatSummary:
+		if p.byRange {
+			fmt.Fprintf(p.w, "Added: %d (%s addresses) | Removed: %d (%s addresses) | Modified: %d (%s addresses)",
+				s.Changes[changeAdded], s.Addresses[changeAdded],
+				s.Changes[changeRemoved], s.Addresses[changeRemoved],
+				s.Changes[changeModified], s.Addresses[changeModified])
+		} else {
+			fmt.Fprintf(p.w, "Added: %d | Removed: %d | Modified: %d",
+				s.Changes[changeAdded], s.Changes[changeRemoved], s.Changes[changeModified])
+		}
+		if p.moves {
+			fmt.Fprintf(p.w, " | Moved: %d", s.Changes[changeMoved])
+		}
+		if len(p.metadata) > 0 {
+			fmt.Fprintf(p.w, " | Metadata: %d", len(p.metadata))
+		}
+		fmt.Fprintln(p.w)
+	case diffFormatText:
+		if len(p.metadata)+s.Changes[changeAdded]+s.Changes[changeRemoved]+s.Changes[changeModified]+s.Changes[changeMoved] > 0 {
+			fmt.Fprintln(p.w)
+		}
+		if len(p.metadata) > 0 {
+			fmt.Fprintf(p.w, "Metadata: %d fields changed\n", len(p.metadata))
+		}
+		if p.byRange {
+			fmt.Fprintf(p.w, "Added: %d ranges, %s addresses\nRemoved: %d ranges, %s addresses\nModified: %d ranges, %s addresses\n",
+				s.Changes[changeAdded], s.Addresses[changeAdded],
+				s.Changes[changeRemoved], s.Addresses[changeRemoved],
+				s.Changes[changeModified], s.Addresses[changeModified])
+		} else {
+			fmt.Fprintf(p.w, "Added: %d\nRemoved: %d\nModified: %d\n",
+				s.Changes[changeAdded], s.Changes[changeRemoved], s.Changes[changeModified])
+		}
+		if p.moves {
+			fmt.Fprintf(p.w, "Moved: %d\n", s.Changes[changeMoved])
+		}
+	}
+	return p.w.Flush()
+}
@@ -0,0 +1,114 @@
+package cmd
+
+import (
+	"encoding/json"
+	"os"
+	"reflect"
+
+	"github.com/maxmind/mmdbwriter/mmdbtype"
+	"github.com/oschwald/maxminddb-golang"
+)
+
+// diffPatch collects the changes found by diff as patch operations that
+// turn the old database into the new one. Removals are applied first, then
+// added networks, then field changes, so that networks which were split or
+// merged are replaced cleanly.
+type diffPatch struct {
+	base     string
+	metadata *patchMetadata
+	removes  []patchOperation
+	sets     []patchOperation
+	fields   []patchOperation
+}
+
+// add records the operations for one change. newTyped is the new record
+// with its MMDB types, so that numbers keep their exact type.
+func (p *diffPatch) add(kind, network string, oldRec, newRec interface{}, newTyped mmdbtype.DataType) {
+	switch kind {
+	case changeRemoved:
+		p.removes = append(p.removes, patchOperation{Op: patchOpRemoveNetwork, Network: network})
+	case changeAdded:
+		record, types := encodePatchValue(newTyped)
+		p.sets = append(p.sets, patchOperation{Op: patchOpSet, Network: network, Record: record, Types: types})
+	case changeModified:
+		var deleted []string
+		for _, c := range diffRecords("", oldRec, newRec) {
+			if c.Op == fieldRemove {
+				deleted = append(deleted, c.Path)
+				continue
+			}
+			value, _ := typedField(newTyped, c.Path)
+			encoded, types := encodePatchValue(value)
+			if c.Path == "" {
+				p.fields = append(p.fields, patchOperation{Op: patchOpSet, Network: network, Record: encoded, Types: types})
+				continue
+			}
+			p.fields = append(p.fields, patchOperation{
+				Op:      patchOpSetField,
+				Network: network,
+				Field:   c.Path,
+				Value:   encoded,
+				Types:   types,
+			})
+		}
+		if len(deleted) > 0 {
+			p.fields = append(p.fields, patchOperation{Op: patchOpDeleteField, Network: network, Fields: deleted})
+		}
+	}
+}
+
+// setMetadata records the metadata fields that differ between the old and
+// the new database. The node count and binary format version follow from
+// the data and are not part of a patch.
+func (p *diffPatch) setMetadata(old, new maxminddb.Metadata) {
+	var m patchMetadata
+	changed := false
+	if old.BuildEpoch != new.BuildEpoch {
+		epoch := int64(new.BuildEpoch)
+		m.BuildEpoch, changed = &epoch, true
+	}
+	if old.DatabaseType != new.DatabaseType {
+		m.DatabaseType, changed = &new.DatabaseType, true
+	}
+	if !reflect.DeepEqual(old.Description, new.Description) && (len(old.Description) > 0 || len(new.Description) > 0) {
+		description := map[string]string{}
+		for lang, text := range new.Description {
+			description[lang] = text
+		}
+		m.Description, changed = &description, true
+	}
+	if old.IPVersion != new.IPVersion {
+		version := int(new.IPVersion)
+		m.IPVersion, changed = &version, true
+	}
+	if !reflect.DeepEqual(old.Languages, new.Languages) && (len(old.Languages) > 0 || len(new.Languages) > 0) {
+		languages := append([]string{}, new.Languages...)
+		m.Languages, changed = &languages, true
+	}
+	if old.RecordSize != new.RecordSize {
+		size := int(new.RecordSize)
+		m.RecordSize, changed = &size, true
+	}
+	if changed {
+		p.metadata = &m
+	}
+}
+
+// size returns the number of operations collected.
+func (p *diffPatch) size() int {
+	return len(p.removes) + len(p.sets) + len(p.fields)
+}
+
+// write writes the patch as JSON to path.
+func (p *diffPatch) write(path string) error {
+	ops := make([]patchOperation, 0, p.size())
+	ops = append(ops, p.removes...)
+	ops = append(ops, p.sets...)
+	ops = append(ops, p.fields...)
+
+	out, err := json.MarshalIndent(patchFile{BaseSHA256: p.base, Metadata: p.metadata, Operations: ops}, "", "  ")
+	if err != nil {
+		return err
+	}
+	return os.WriteFile(path, append(out, '\n'), 0644)
+}
@@ -0,0 +1,142 @@
+package cmd
+
+import (
+	"net/netip"
+	"reflect"
+
+	"github.com/maxmind/mmdbwriter/mmdbtype"
+	"go4.org/netipx"
+)
+
+// Kinds of change reported by diff.
+const (
+	changeAdded    = "added"
+	changeRemoved  = "removed"
+	changeModified = "modified"
+)
+
+// rangeChange is a run of addresses whose effective record differs between
+// the old and the new database. Range is in the shared IPv6 tree space.
+type rangeChange struct {
+	Kind     string
+	Range    netipx.IPRange
+	Old      interface{}
+	New      interface{}
+	NewTyped mmdbtype.DataType
+}
+
+// diffByRange walks both databases over the same address space and calls
+// emit for every maximal range in which the effective record differs.
+// Adjacent ranges with the same change are coalesced, so a network that is
+// split or merged with unchanged data produces no change at all. Only the
+// current network of each side is held in memory.
+func diffByRange(oldNets, newNets *networkStream, emit func(rangeChange) error) error {
+	var pending *rangeChange
+	flush := func() error {
+		if pending == nil {
+			return nil
+		}
+		c := *pending
+		pending = nil
+		return emit(c)
+	}
+	record := func(c rangeChange) error {
+		if pending != nil && pending.Kind == c.Kind &&
+			pending.Range.To().Next() == c.Range.From() &&
+			reflect.DeepEqual(pending.Old, c.Old) && reflect.DeepEqual(pending.New, c.New) {
+			pending.Range = netipx.IPRangeFrom(pending.Range.From(), c.Range.To())
+			return nil
+		}
+		if err := flush(); err != nil {
+			return err
+		}
+		pending = &c
+		return nil
+	}
+
+	var cursor netip.Addr
+	for {
+		o, hasOld := oldNets.peek()
+		n, hasNew := newNets.peek()
+		if !hasOld && !hasNew {
+			break
+		}
+
+		// Skip addresses that neither database covers
+		start := cursor
+		switch {
+		case !hasOld:
+			start = maxAddr(start, n.Range.From())
+		case !hasNew:
+			start = maxAddr(start, o.Range.From())
+		default:
+			start = maxAddr(start, minAddr(o.Range.From(), n.Range.From()))
+		}
+
+		// The segment ends where either side's coverage next changes
+		var end netip.Addr
+		var oldRec, newRec interface{}
+		var newTyped mmdbtype.DataType
+		inOld := hasOld && !start.Less(o.Range.From())
+		inNew := hasNew && !start.Less(n.Range.From())
+		switch {
+		case inOld && inNew:
+			end = minAddr(o.Range.To(), n.Range.To())
+			oldRec, newRec, newTyped = o.Record, n.Record, n.Typed
+		case inOld:
+			end = o.Range.To()
+			if hasNew {
+				end = minAddr(end, n.Range.From().Prev())
+			}
+			oldRec = o.Record
+		default:
+			end = n.Range.To()
+			if hasOld {
+				end = minAddr(end, o.Range.From().Prev())
+			}
+			newRec, newTyped = n.Record, n.Typed
+		}
+
+		var kind string
+		switch {
+		case oldRec == nil:
+			kind = changeAdded
+		case newRec == nil:
+			kind = changeRemoved
+		case !reflect.DeepEqual(oldRec, newRec):
+			kind = changeModified
+		}
+		if kind != "" {
+			if err := record(rangeChange{Kind: kind, Range: netipx.IPRangeFrom(start, end), Old: oldRec, New: newRec, NewTyped: newTyped}); err != nil {
+				return err
+			}
+		}
+
+		if inOld && o.Range.To() == end {
+			oldNets.next()
+		}
+		if inNew && n.Range.To() == end {
+			newNets.next()
+		}
+		if !end.Next().IsValid() {
+			break
+		}
+		cursor = end.Next()
+	}
+
+	if err := oldNets.Err(); err != nil {
+		return err
+	}
+	if err := newNets.Err(); err != nil {
+		return err
+	}
+	return flush()
+}
+
+// maxAddr returns the higher of two addresses.
+func maxAddr(a, b netip.Addr) netip.Addr {
+	if a.Less(b) {
+		return b
+	}
+	return a
+}
@@ -0,0 +1,142 @@
+package cmd
+
+import (
+	"net"
+	"path/filepath"
+	"reflect"
+	"testing"
+
+	"github.com/maxmind/mmdbwriter"
+	"github.com/maxmind/mmdbwriter/mmdbtype"
+	"github.com/oschwald/maxminddb-golang"
+)
+
+// testNetwork is a network and its record for openTestDB.
+type testNetwork struct {
+	Network string
+	Record  mmdbtype.DataType
+}
+
+// openTestDB writes networks to a database in a temporary directory and
+// opens it. Networks are inserted in order, so later ones replace earlier
+// ones where they overlap.
+func openTestDB(t *testing.T, networks []testNetwork) *maxminddb.Reader {
+	t.Helper()
+	tree, err := mmdbwriter.New(mmdbwriter.Options{
+		DatabaseType:            "test",
+		IncludeReservedNetworks: true,
+		DisableIPv4Aliasing:     true,
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, n := range networks {
+		_, network, err := net.ParseCIDR(n.Network)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if err := tree.Insert(network, n.Record); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	path := filepath.Join(t.TempDir(), "test.mmdb")
+	if err := writeTree(tree, path, 1); err != nil {
+		t.Fatal(err)
+	}
+	db, err := maxminddb.Open(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { db.Close() })
+	return db
+}
+
+func testRecord(value string) mmdbtype.Map {
+	return mmdbtype.Map{"v": mmdbtype.String(value)}
+}
+
+func TestDiffByRange(t *testing.T) {
+	tests := []struct {
+		name string
+		old  []testNetwork
+		new  []testNetwork
+		want []string
+	}{
+		{
+			name: "unchanged",
+			old:  []testNetwork{{"10.0.0.0/24", testRecord("a")}},
+			new:  []testNetwork{{"10.0.0.0/24", testRecord("a")}},
+		},
+		{
+			name: "split with the same data",
+			old:  []testNetwork{{"10.0.0.0/23", testRecord("a")}},
+			new:  []testNetwork{{"10.0.0.0/24", testRecord("a")}, {"10.0.1.0/24", testRecord("a")}},
+		},
+		{
+			name: "merged with the same data",
+			old:  []testNetwork{{"10.0.0.0/24", testRecord("a")}, {"10.0.1.0/24", testRecord("a")}},
+			new:  []testNetwork{{"10.0.0.0/23", testRecord("a")}},
+		},
+		{
+			name: "split with changed data",
+			old:  []testNetwork{{"10.0.0.0/23", testRecord("a")}},
+			new:  []testNetwork{{"10.0.0.0/24", testRecord("a")}, {"10.0.1.0/24", testRecord("b")}},
+			want: []string{"modified 10.0.1.0/24"},
+		},
+		{
+			name: "merged with changed data",
+			old:  []testNetwork{{"10.0.0.0/24", testRecord("a")}, {"10.0.1.0/24", testRecord("b")}},
+			new:  []testNetwork{{"10.0.0.0/23", testRecord("c")}},
+			want: []string{"modified 10.0.0.0/24", "modified 10.0.1.0/24"},
+		},
+		{
+			name: "changes coalesced over a network boundary",
+			old:  []testNetwork{{"10.0.0.0/24", testRecord("a")}, {"10.0.1.0/24", testRecord("a")}},
+			new:  []testNetwork{{"10.0.0.0/23", testRecord("b")}},
+			want: []string{"modified 10.0.0.0/23"},
+		},
+		{
+			name: "network moved over a boundary",
+			old:  []testNetwork{{"10.0.0.0/24", testRecord("a")}},
+			new:  []testNetwork{{"10.0.0.128/25", testRecord("a")}, {"10.0.1.0/25", testRecord("a")}},
+			want: []string{"removed 10.0.0.0/25", "added 10.0.1.0/25"},
+		},
+		{
+			name: "range crossing a boundary",
+			old:  []testNetwork{{"10.0.0.0/25", testRecord("a")}, {"10.0.0.128/25", testRecord("b")}},
+			new:  []testNetwork{{"10.0.0.0/24", testRecord("a")}},
+			want: []string{"modified 10.0.0.128/25"},
+		},
+		{
+			name: "partly removed",
+			old:  []testNetwork{{"10.0.0.0/24", testRecord("a")}, {"2001:db8::/48", testRecord("a")}},
+			new:  []testNetwork{{"10.0.0.0/25", testRecord("a")}, {"2001:db8::/48", testRecord("a")}},
+			want: []string{"removed 10.0.0.128/25"},
+		},
+		{
+			name: "IPv6 added",
+			old:  []testNetwork{{"10.0.0.0/24", testRecord("a")}},
+			new:  []testNetwork{{"10.0.0.0/24", testRecord("a")}, {"2001:db8::/48", testRecord("a")}},
+			want: []string{"added 2001:db8::/48"},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			oldNets := newNetworkStream(openTestDB(t, tt.old), recordFilter{}, nil)
+			newNets := newNetworkStream(openTestDB(t, tt.new), recordFilter{}, nil)
+
+			var got []string
+			err := diffByRange(oldNets, newNets, func(c rangeChange) error {
+				got = append(got, c.Kind+" "+newRangeChange(c).Network)
+				return nil
+			})
+			if err != nil {
+				t.Fatal(err)
+			}
+			if !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("diffByRange() = %q, want %q", got, tt.want)
+			}
+		})
+	}
+}
@@ -0,0 +1,456 @@
+package cmd
+
+import (
+	"fmt"
+	htmltemplate "html/template"
+	"io"
+	"math/big"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	texttemplate "text/template"
+)
+
+// Limits of the tables in a diff report.
+const (
+	reportSamples = 10
+	reportFields  = 20
+	reportTop     = 20
+)
+
+// diffReport collects what a human-readable diff report shows: counts and
+// addresses per kind and family, the most changed fields and samples of
+// every kind of change.
+type diffReport struct {
+	old, new  string
+	kinds     []string
+	counts    map[string]int
+	addresses map[string]familyCounts
+	fields    map[string]*reportField
+	samples   map[string][]diffChange
+	metadata  []fieldChange
+}
+
+// reportField counts the modified networks in which a field changed.
+type reportField struct {
+	Path      string
+	Networks  int
+	Addresses *big.Int
+}
+
+// newDiffReport returns an empty report comparing old with new.
+func newDiffReport(old, new string) *diffReport {
+	r := &diffReport{
+		old:       old,
+		new:       new,
+		counts:    map[string]int{},
+		addresses: map[string]familyCounts{},
+		fields:    map[string]*reportField{},
+		samples:   map[string][]diffChange{},
+	}
+	for _, kind := range []string{changeAdded, changeRemoved, changeModified} {
+		r.addKind(kind)
+	}
+	return r
+}
+
+// addKind adds a change kind to the report tables.
+func (r *diffReport) addKind(kind string) {
+	r.kinds = append(r.kinds, kind)
+	r.counts[kind] = 0
+	r.addresses[kind] = newFamilyCounts()
+}
+
+// add counts c.
+func (r *diffReport) add(c diffChange) {
+	if _, ok := r.counts[c.Kind]; !ok {
+		r.addKind(c.Kind)
+	}
+	r.counts[c.Kind]++
+	r.addresses[c.Kind].add(networkFamily(c.Network), c.Addresses)
+
+	seen := map[string]bool{}
+	for _, fc := range c.Changes {
+		path := fc.Path
+		if path == "" {
+			path = "(record)"
+		}
+		if seen[path] {
+			continue
+		}
+		seen[path] = true
+		f, ok := r.fields[path]
+		if !ok {
+			f = &reportField{Path: path, Addresses: new(big.Int)}
+			r.fields[path] = f
+		}
+		f.Networks++
+		f.Addresses.Add(f.Addresses, c.Addresses)
+	}
+
+	if len(r.samples[c.Kind]) < reportSamples {
+		r.samples[c.Kind] = append(r.samples[c.Kind], c)
+	}
+}
+
+// reportData is what the report templates render.
+type reportData struct {
+	Old, New    string
+	Kinds       []reportKind
+	Total       reportKind
+	Metadata    []string
+	Fields      []reportField
+	MoreFields  int
+	GroupBy     string
+	Transitions []transition
+	Samples     []reportSampleGroup
+}
+
+// reportKind is one row of the summary table.
+type reportKind struct {
+	Kind      string
+	Count     int
+	IPv4      *big.Int
+	IPv6      *big.Int
+	Addresses *big.Int
+}
+
+// reportSampleGroup lists the first changes of one kind.
+type reportSampleGroup struct {
+	Kind    string
+	Count   int
+	Changes []reportSample
+}
+
+// reportSample is one sampled change, ready to print.
+type reportSample struct {
+	Network   string
+	Addresses *big.Int
+	Details   []string
+}
+
+// data returns the report contents. matrix, if not nil, provides the
+// transition table.
+func (r *diffReport) data(matrix *transitionMatrix, top int) reportData {
+	d := reportData{
+		Old:   r.old,
+		New:   r.new,
+		Total: reportKind{Kind: "total", IPv4: new(big.Int), IPv6: new(big.Int), Addresses: new(big.Int)},
+	}
+	for _, kind := range r.kinds {
+		k := reportKind{
+			Kind:      kind,
+			Count:     r.counts[kind],
+			IPv4:      r.addresses[kind][familyIPv4],
+			IPv6:      r.addresses[kind][familyIPv6],
+			Addresses: new(big.Int).Add(r.addresses[kind][familyIPv4], r.addresses[kind][familyIPv6]),
+		}
+		d.Kinds = append(d.Kinds, k)
+		d.Total.Count += k.Count
+		d.Total.IPv4.Add(d.Total.IPv4, k.IPv4)
+		d.Total.IPv6.Add(d.Total.IPv6, k.IPv6)
+		d.Total.Addresses.Add(d.Total.Addresses, k.Addresses)
+	}
+
+	for _, fc := range r.metadata {
+		d.Metadata = append(d.Metadata, formatFieldChange(fc))
+	}
+
+	for _, f := range r.fields {
+		d.Fields = append(d.Fields, *f)
+	}
+	sort.Slice(d.Fields, func(i, j int) bool {
+		if d.Fields[i].Networks != d.Fields[j].Networks {
+			return d.Fields[i].Networks > d.Fields[j].Networks
+		}
+		if c := d.Fields[i].Addresses.Cmp(d.Fields[j].Addresses); c != 0 {
+			return c > 0
+		}
+		return d.Fields[i].Path < d.Fields[j].Path
+	})
+	if len(d.Fields) > reportFields {
+		d.MoreFields = len(d.Fields) - reportFields
+		d.Fields = d.Fields[:reportFields]
+	}
+
+	if matrix != nil {
+		if top <= 0 {
+			top = reportTop
+		}
+		d.GroupBy = matrix.path
+		d.Transitions = matrix.sortedTransitions()
+		if len(d.Transitions) > top {
+			d.Transitions = d.Transitions[:top]
+		}
+	}
+
+	for _, kind := range r.kinds {
+		group := reportSampleGroup{Kind: kind, Count: r.counts[kind]}
+		for _, c := range r.samples[kind] {
+			s := reportSample{Network: c.Network, Addresses: c.Addresses}
+			if c.From != "" {
+				s.Network = c.From + " → " + c.Network
+			}
+			if c.Record != nil {
+				s.Details = append(s.Details, compactJSON(c.Record))
+			}
+			for _, fc := range c.Changes {
+				s.Details = append(s.Details, formatFieldChange(fc))
+			}
+			group.Changes = append(group.Changes, s)
+		}
+		d.Samples = append(d.Samples, group)
+	}
+	return d
+}
+
+// write renders the report to path, as HTML or Markdown depending on its
+// extension.
+func (r *diffReport) write(path string, matrix *transitionMatrix, top int) error {
+	f, err := os.Create(path)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+
+	data := r.data(matrix, top)
+	if isMarkdownReport(path) {
+		err = renderMarkdownReport(f, data)
+	} else {
+		err = renderHTMLReport(f, data)
+	}
+	if err != nil {
+		return err
+	}
+	return f.Close()
+}
+
+// checkReportPath returns an error if path does not name an HTML or
+// Markdown file.
+func checkReportPath(path string) error {
+	switch strings.ToLower(filepath.Ext(path)) {
+	case ".html", ".htm", ".md", ".markdown":
+		return nil
+	default:
+		return fmt.Errorf("--report must end in .html or .md")
+	}
+}
+
+// isMarkdownReport reports whether path names a Markdown report.
+func isMarkdownReport(path string) bool {
+	ext := strings.ToLower(filepath.Ext(path))
+	return ext == ".md" || ext == ".markdown"
+}
+
+// formatCount prints n with thousands separators.
+func formatCount(n interface{}) string {
+	var s string
+	switch v := n.(type) {
+	case *big.Int:
+		s = v.String()
+	default:
+		s = fmt.Sprint(v)
+	}
+	neg := strings.HasPrefix(s, "-")
+	s = strings.TrimPrefix(s, "-")
+	var b strings.Builder
+	for i, c := range s {
+		if i > 0 && (len(s)-i)%3 == 0 {
+			b.WriteByte(',')
+		}
+		b.WriteRune(c)
+	}
+	if neg {
+		return "-" + b.String()
+	}
+	return b.String()
+}
+
+// markdownCell escapes a value for a Markdown table cell.
+func markdownCell(v interface{}) string {
+	s := fmt.Sprint(v)
+	s = strings.ReplaceAll(s, "|", `\|`)
+	return strings.ReplaceAll(s, "\n", " ")
+}
+
+var reportFuncs = map[string]interface{}{
+	"count": formatCount,
+	"value": displayValue,
+	"cell":  markdownCell,
+	"title": func(s string) string {
+		if s == "" {
+			return s
+		}
+		return strings.ToUpper(s[:1]) + s[1:]
+	},
+}
+
+func renderHTMLReport(w io.Writer, data reportData) error {
+	t, err := htmltemplate.New("report").Funcs(htmltemplate.FuncMap(reportFuncs)).Parse(htmlReportTemplate)
+	if err != nil {
+		return err
+	}
+	return t.Execute(w, data)
+}
+
+func renderMarkdownReport(w io.Writer, data reportData) error {
+	t, err := texttemplate.New("report").Funcs(texttemplate.FuncMap(reportFuncs)).Parse(markdownReportTemplate)
+	if err != nil {
+		return err
+	}
+	return t.Execute(w, data)
+}
+
+const htmlReportTemplate = `<!DOCTYPE html>
+<html lang="en">
+<head>
+<meta charset="utf-8">
+<title>MMDB diff: {{.Old}} → {{.New}}</title>
+<style>
+body { font-family: -apple-system, "Segoe UI", Helvetica, Arial, sans-serif; margin: 2em auto; max-width: 60em; padding: 0 1em; color: #222; }
+h1 { font-size: 1.5em; }
+h2 { font-size: 1.2em; margin-top: 2em; border-bottom: 1px solid #ddd; padding-bottom: .2em; }
+table { border-collapse: collapse; margin: .5em 0; }
+th, td { border: 1px solid #ddd; padding: .3em .7em; text-align: left; vertical-align: top; }
+th { background: #f5f5f5; }
+td.num { text-align: right; font-variant-numeric: tabular-nums; }
+tr.total td { font-weight: bold; }
+code, .details { font-family: ui-monospace, Menlo, Consolas, monospace; font-size: .9em; }
+.details div { white-space: pre-wrap; word-break: break-all; }
+.added { color: #1a7f37; } .removed { color: #cf222e; } .modified { color: #9a6700; } .moved { color: #0969da; }
+.muted { color: #777; }
+</style>
+</head>
+<body>
+<h1>MMDB diff</h1>
+<p><code>{{.Old}}</code> → <code>{{.New}}</code></p>
+
+<h2>Summary</h2>
+<table>
+<tr><th>Change</th><th>Networks</th><th>IPv4 addresses</th><th>IPv6 addresses</th></tr>
+{{- range .Kinds}}
+<tr><td class="{{.Kind}}">{{title .Kind}}</td><td class="num">{{count .Count}}</td><td class="num">{{count .IPv4}}</td><td class="num">{{count .IPv6}}</td></tr>
+{{- end}}
+<tr class="total"><td>Total</td><td class="num">{{count .Total.Count}}</td><td class="num">{{count .Total.IPv4}}</td><td class="num">{{count .Total.IPv6}}</td></tr>
+</table>
+
+<h2>Metadata</h2>
+{{- if .Metadata}}
+<ul>
+{{- range .Metadata}}
+<li><code>{{.}}</code></li>
+{{- end}}
+</ul>
+{{- else}}
+<p class="muted">No metadata changes.</p>
+{{- end}}
+
+<h2>Top changed fields</h2>
+{{- if .Fields}}
+<table>
+<tr><th>Field</th><th>Networks</th><th>Addresses</th></tr>
+{{- range .Fields}}
+<tr><td><code>{{.Path}}</code></td><td class="num">{{count .Networks}}</td><td class="num">{{count .Addresses}}</td></tr>
+{{- end}}
+</table>
+{{- if .MoreFields}}
+<p class="muted">… and {{.MoreFields}} more fields.</p>
+{{- end}}
+{{- else}}
+<p class="muted">No modified fields.</p>
+{{- end}}
+
+<h2>Value transitions{{if .GroupBy}}: <code>{{.GroupBy}}</code>{{end}}</h2>
+{{- if .GroupBy}}
+{{- if .Transitions}}
+<table>
+<tr><th>From</th><th>To</th><th>Addresses</th><th>Networks</th></tr>
+{{- range .Transitions}}
+<tr><td>{{value .From}}</td><td>{{value .To}}</td><td class="num">{{count .Addresses}}</td><td class="num">{{count .Networks}}</td></tr>
+{{- end}}
+</table>
+{{- else}}
+<p class="muted">No changes in <code>{{.GroupBy}}</code>.</p>
+{{- end}}
+{{- else}}
+<p class="muted">Run diff with --group-by to include a transition table.</p>
+{{- end}}
+
+<h2>Samples</h2>
+{{- range .Samples}}
+<h3 class="{{.Kind}}">{{title .Kind}} ({{count .Count}})</h3>
+{{- if .Changes}}
+<table>
+<tr><th>Network</th><th>Addresses</th><th>Details</th></tr>
+{{- range .Changes}}
+<tr><td><code>{{.Network}}</code></td><td class="num">{{count .Addresses}}</td><td class="details">{{range .Details}}<div>{{.}}</div>{{end}}</td></tr>
+{{- end}}
+</table>
+{{- else}}
+<p class="muted">None.</p>
+{{- end}}
+{{- end}}
+</body>
+</html>
+`
+
+const markdownReportTemplate = `# MMDB diff
+
+` + "`{{.Old}}`" + ` → ` + "`{{.New}}`" + `
+
+## Summary
+
+| Change | Networks | IPv4 addresses | IPv6 addresses |
+|---|---:|---:|---:|
+{{- range .Kinds}}
+| {{title .Kind}} | {{count .Count}} | {{count .IPv4}} | {{count .IPv6}} |
+{{- end}}
+| **Total** | **{{count .Total.Count}}** | **{{count .Total.IPv4}}** | **{{count .Total.IPv6}}** |
+
+## Metadata
+{{if .Metadata}}
+{{range .Metadata}}- ` + "`{{.}}`" + `
+{{end}}
+{{- else}}
+No metadata changes.
+{{end}}
+## Top changed fields
+{{if .Fields}}
+| Field | Networks | Addresses |
+|---|---:|---:|
+{{- range .Fields}}
+| ` + "`{{cell .Path}}`" + ` | {{count .Networks}} | {{count .Addresses}} |
+{{- end}}
+{{if .MoreFields}}
+… and {{.MoreFields}} more fields.
+{{end}}
+{{- else}}
+No modified fields.
+{{end}}
+## Value transitions{{if .GroupBy}}: ` + "`{{.GroupBy}}`" + `{{end}}
+{{if .GroupBy}}{{if .Transitions}}
+| From | To | Addresses | Networks |
+|---|---|---:|---:|
+{{- range .Transitions}}
+| {{cell (value .From)}} | {{cell (value .To)}} | {{count .Addresses}} | {{count .Networks}} |
+{{- end}}
+{{else}}
+No changes in ` + "`{{.GroupBy}}`" + `.
+{{end}}{{else}}
+Run diff with --group-by to include a transition table.
+{{end}}
+## Samples
+{{range .Samples}}
+### {{title .Kind}} ({{count .Count}})
+{{if .Changes}}
+| Network | Addresses | Details |
+|---|---:|---|
+{{- range .Changes}}
+| ` + "`{{cell .Network}}`" + ` | {{count .Addresses}} | {{range $i, $d := .Details}}{{if $i}}<br>{{end}}` + "`{{cell $d}}`" + `{{end}} |
+{{- end}}
+{{else}}
+None.
+{{end}}
+{{- end}}
+`
@@ -0,0 +1,297 @@
+package cmd
+
+import (
+	"encoding/json"
+	"fmt"
+	"math/big"
+	"net/netip"
+	"os"
+	"path/filepath"
+	"reflect"
+	"sort"
+	"strings"
+
+	"github.com/oschwald/maxminddb-golang"
+	"go4.org/netipx"
+)
+
+// sourceFormatFor returns the import format of a source file judged by its
+// extension, and false if the file does not look like an import source.
+func sourceFormatFor(path string) (string, bool) {
+	switch strings.ToLower(filepath.Ext(path)) {
+	case ".json":
+		return formatJSON, true
+	case ".ndjson", ".jsonl":
+		return formatNDJSON, true
+	case ".csv":
+		return formatCSV, true
+	case ".txt", ".list", ".lst":
+		return formatList, true
+	default:
+		return "", false
+	}
+}
+
+// sourceResult is a change found by diffSource, with the records on either
+// side for thresholds and --group-by.
+type sourceResult struct {
+	change         diffChange
+	rng            netipx.IPRange
+	oldRec, newRec interface{}
+}
+
+// diffSource compares the entries of an import source with the data db has
+// for them, and reports every key whose addresses in db do not all carry
+// the source record ("modified", or "removed" if db has no data for it),
+// and every network in db outside all keys ("added"). Records are compared
+// as import would store them, with list records from record and nulls
+// handled as in nulls, and overlapping keys are resolved by overlap as
+// import does, so a key is only checked where it wins. It returns the
+// number of addresses per family the source covers.
+func diffSource(path, format, record, overlap string, db *maxminddb.Reader, filter recordFilter, nulls string, report func(c diffChange, oldRec, newRec interface{}) error) (familyCounts, error) {
+	data, err := readEntries(path, format, record)
+	if err != nil {
+		return nil, err
+	}
+
+	var entries []importEntry
+	wants := map[int]interface{}{}
+	for _, entry := range data {
+		r, warning, err := parseNetworkKey(entry.Key)
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "warn: %s: skipping invalid key %q: %v\n", path, entry.Key, err)
+			continue
+		}
+		if warning != "" {
+			fmt.Fprintf(os.Stderr, "warn: %s: %s\n", path, warning)
+		}
+		converted, err := convertToMMDBType(entry.Record, nulls)
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "warn: %s: skipping %s: %v\n", path, entry.Key, err)
+			continue
+		}
+		if converted == nil {
+			// Skipped by import as well.
+			continue
+		}
+		plain, _ := encodePatchValue(converted)
+		wants[entry.Index] = filter.apply(normalizeRecord(plain))
+		entry.Range = r
+		entries = append(entries, entry)
+	}
+
+	ordered := orderEntries(entries, overlap)
+	conflicts := findOverlaps(ordered, overlap, "none")
+	if len(conflicts) > 0 && overlap == overlapError {
+		c := conflicts[0]
+		return nil, fmt.Errorf("%s: %d overlapping network pairs found, first: %s and %s overlap at %s",
+			path, len(conflicts), c.First, c.Second, c.Overlap)
+	}
+	shadows := shadowingRanges(ordered, conflicts)
+
+	var results []sourceResult
+	var covered netipx.IPSetBuilder
+	for _, entry := range entries {
+		tree := treeRange(entry.Range)
+		covered.AddRange(tree)
+		owned := []netipx.IPRange{tree}
+		if len(shadows[entry.Index]) > 0 {
+			var b netipx.IPSetBuilder
+			b.AddRange(tree)
+			for _, r := range shadows[entry.Index] {
+				b.RemoveRange(r)
+			}
+			set, err := b.IPSet()
+			if err != nil {
+				return nil, err
+			}
+			if owned = set.Ranges(); len(owned) == 0 {
+				// Every address is taken by other keys.
+				continue
+			}
+		}
+		result, err := checkSourceEntry(db, entry.Key, tree, owned, wants[entry.Index], filter)
+		if err != nil {
+			return nil, err
+		}
+		if result != nil {
+			results = append(results, *result)
+		}
+	}
+	coverage, err := covered.IPSet()
+	if err != nil {
+		return nil, err
+	}
+
+	extra, err := uncoveredNetworks(db, coverage, filter)
+	if err != nil {
+		return nil, err
+	}
+	results = append(results, extra...)
+
+	sort.SliceStable(results, func(i, j int) bool {
+		return rangeLess(results[i].rng, results[j].rng)
+	})
+	for _, r := range results {
+		if err := report(r.change, r.oldRec, r.newRec); err != nil {
+			return nil, err
+		}
+	}
+
+	total := newFamilyCounts()
+	for _, r := range coverage.Ranges() {
+		total.add(treeFamily(r), rangeSize(r))
+	}
+	return total, nil
+}
+
+// shadowingRanges returns, for the index of every entry that loses an
+// overlap, the tree ranges of the entries that win it. ordered is the
+// insertion order from orderEntries, in which later entries win.
+func shadowingRanges(ordered []importEntry, conflicts []overlapConflict) map[int][]netipx.IPRange {
+	rank := make(map[int]int, len(ordered))
+	byIndex := make(map[int]importEntry, len(ordered))
+	for i, e := range ordered {
+		rank[e.Index] = i
+		byIndex[e.Index] = e
+	}
+	shadows := map[int][]netipx.IPRange{}
+	for _, c := range conflicts {
+		loser, winner := c.FirstPosition-1, c.SecondPosition-1
+		if rank[loser] > rank[winner] {
+			loser, winner = winner, loser
+		}
+		shadows[loser] = append(shadows[loser], treeRange(byIndex[winner].Range))
+	}
+	return shadows
+}
+
+// checkSourceEntry compares the data db has for the owned parts of the tree
+// range of a source key with the record want. It returns nil if every owned
+// address carries want.
+func checkSourceEntry(db *maxminddb.Reader, key string, tree netipx.IPRange, owned []netipx.IPRange, want interface{}, filter recordFilter) (*sourceResult, error) {
+	size := new(big.Int)
+	var prefixes []netip.Prefix
+	for _, r := range owned {
+		size.Add(size, rangeSize(r))
+		prefixes = append(prefixes, r.Prefixes()...)
+	}
+	found := new(big.Int)
+	differing := new(big.Int)
+	var sample interface{}
+
+	for _, prefix := range scopesFor(db, prefixes) {
+		scope := treeRange(netipx.RangeOfPrefix(prefix))
+		networks := db.NetworksWithin(netipx.PrefixIPNet(prefix), maxminddb.SkipAliasedNetworks)
+		for networks.Next() {
+			var record interface{}
+			network, err := networks.Network(&record)
+			if err != nil {
+				return nil, err
+			}
+			p, ok := netipx.FromStdIPNet(network)
+			if !ok {
+				return nil, fmt.Errorf("invalid network %s", network)
+			}
+			n := treeRange(netipx.RangeOfPrefix(p))
+			clipped := rangeSize(netipx.IPRangeFrom(maxAddr(n.From(), scope.From()), minAddr(n.To(), scope.To())))
+			found.Add(found, clipped)
+
+			got := filter.apply(normalizeRecord(record))
+			if !reflect.DeepEqual(got, want) {
+				differing.Add(differing, clipped)
+				if sample == nil {
+					sample = got
+				}
+			}
+		}
+		if err := networks.Err(); err != nil {
+			return nil, err
+		}
+	}
+
+	missing := new(big.Int).Sub(size, found)
+	switch {
+	case found.Sign() == 0:
+		return &sourceResult{
+			change: diffChange{Kind: changeRemoved, Network: key, Addresses: size, Record: want},
+			rng:    tree,
+			oldRec: want,
+		}, nil
+	case differing.Sign() == 0 && missing.Sign() == 0:
+		return nil, nil
+	}
+
+	var changes []fieldChange
+	if sample != nil {
+		changes = diffRecords("", want, sample)
+	}
+	if missing.Sign() > 0 {
+		changes = append(changes, fieldChange{Op: fieldRemove, Path: "", Old: want})
+	}
+	return &sourceResult{
+		change: diffChange{
+			Kind:      changeModified,
+			Network:   key,
+			Addresses: differing.Add(differing, missing),
+			Changes:   changes,
+		},
+		rng:    tree,
+		oldRec: want,
+		newRec: sample,
+	}, nil
+}
+
+// uncoveredNetworks returns the parts of the networks of db that no source
+// key covers.
+func uncoveredNetworks(db *maxminddb.Reader, coverage *netipx.IPSet, filter recordFilter) ([]sourceResult, error) {
+	var results []sourceResult
+	networks := db.Networks(maxminddb.SkipAliasedNetworks)
+	for networks.Next() {
+		var record interface{}
+		network, err := networks.Network(&record)
+		if err != nil {
+			return nil, err
+		}
+		p, ok := netipx.FromStdIPNet(network)
+		if !ok {
+			return nil, fmt.Errorf("invalid network %s", network)
+		}
+		n := treeRange(netipx.RangeOfPrefix(p))
+		if coverage.ContainsRange(n) {
+			continue
+		}
+
+		var b netipx.IPSetBuilder
+		b.AddRange(n)
+		b.RemoveSet(coverage)
+		rest, err := b.IPSet()
+		if err != nil {
+			return nil, err
+		}
+		rec := filter.apply(normalizeRecord(record))
+		for _, r := range rest.Ranges() {
+			results = append(results, sourceResult{
+				change: diffChange{Kind: changeAdded, Network: formatRange(treeToRange(r)), Addresses: rangeSize(r), Record: rec},
+				rng:    r,
+				newRec: rec,
+			})
+		}
+	}
+	return results, networks.Err()
+}
+
+// normalizeRecord returns v as decoded from JSON, so that records read
+// from a source and from a database compare equal regardless of the Go
+// types their numbers were decoded to.
+func normalizeRecord(v interface{}) interface{} {
+	data, err := json.Marshal(v)
+	if err != nil {
+		return v
+	}
+	var out interface{}
+	if err := json.Unmarshal(data, &out); err != nil {
+		return v
+	}
+	return out
+}
@@ -0,0 +1,87 @@
+package cmd
+
+import (
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+)
+
+func TestDiffSourceShadowedKeys(t *testing.T) {
+	tests := []struct {
+		name    string
+		source  string
+		overlap string
+		db      []testNetwork
+		want    []string
+	}{
+		{
+			name:    "shadowed part not compared",
+			source:  `{"10.0.0.0/16": {"v": "a"}, "10.0.1.0/24": {"v": "b"}}`,
+			overlap: overlapSpecific,
+			db:      []testNetwork{{"10.0.0.0/16", testRecord("a")}, {"10.0.1.0/24", testRecord("b")}},
+		},
+		{
+			name:    "fully shadowed key skipped",
+			source:  `{"10.0.0.0/24": {"v": "a"}, "10.0.0.0/25": {"v": "b"}, "10.0.0.128/25": {"v": "c"}}`,
+			overlap: overlapSpecific,
+			db:      []testNetwork{{"10.0.0.0/25", testRecord("b")}, {"10.0.0.128/25", testRecord("c")}},
+		},
+		{
+			name:    "change in the owned part of a shadowed key",
+			source:  `{"10.0.0.0/16": {"v": "a"}, "10.0.1.0/24": {"v": "b"}}`,
+			overlap: overlapSpecific,
+			db: []testNetwork{
+				{"10.0.0.0/16", testRecord("a")},
+				{"10.0.1.0/24", testRecord("b")},
+				{"10.0.2.0/24", testRecord("x")},
+			},
+			want: []string{"modified 10.0.0.0/16"},
+		},
+		{
+			name:    "change in the winning key",
+			source:  `{"10.0.0.0/16": {"v": "a"}, "10.0.1.0/24": {"v": "b"}}`,
+			overlap: overlapSpecific,
+			db:      []testNetwork{{"10.0.0.0/16", testRecord("a")}},
+			want:    []string{"modified 10.0.1.0/24"},
+		},
+		{
+			name:    "later key wins in file order",
+			source:  `{"10.0.1.0/24": {"v": "b"}, "10.0.0.0/16": {"v": "a"}}`,
+			overlap: overlapFile,
+			db:      []testNetwork{{"10.0.0.0/16", testRecord("a")}},
+		},
+		{
+			name:    "data outside all keys",
+			source:  `{"10.0.0.0/24": {"v": "a"}, "10.0.0.0/25": {"v": "b"}}`,
+			overlap: overlapSpecific,
+			db: []testNetwork{
+				{"10.0.0.0/24", testRecord("a")},
+				{"10.0.0.0/25", testRecord("b")},
+				{"10.0.1.0/24", testRecord("c")},
+			},
+			want: []string{"added 10.0.1.0/24"},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			path := filepath.Join(t.TempDir(), "source.json")
+			if err := os.WriteFile(path, []byte(tt.source), 0644); err != nil {
+				t.Fatal(err)
+			}
+			db := openTestDB(t, tt.db)
+
+			var got []string
+			_, err := diffSource(path, formatJSON, "", tt.overlap, db, recordFilter{}, nullEmpty, func(c diffChange, oldRec, newRec interface{}) error {
+				got = append(got, c.Kind+" "+c.Network)
+				return nil
+			})
+			if err != nil {
+				t.Fatal(err)
+			}
+			if !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("diffSource() = %q, want %q", got, tt.want)
+			}
+		})
+	}
+}
@@ -0,0 +1,263 @@
+package cmd
+
+import (
+	"fmt"
+	"net/netip"
+	"os"
+	"reflect"
+	"sort"
+
+	"github.com/maxmind/mmdbwriter/mmdbtype"
+	"github.com/oschwald/maxminddb-golang"
+	"go4.org/netipx"
+)
+
+// diffNetwork is a network read from one side of a diff.
+type diffNetwork struct {
+	// Network is the network as stored, with IPv4 networks in IPv4 form.
+	Network netip.Prefix
+	// Range is the position of the network in an IPv6 tree, with IPv4
+	// networks in ::/96, so that IPv4 and IPv6 databases share one
+	// address space.
+	Range  netipx.IPRange
+	Record interface{}
+	// Typed is the record with its MMDB types, if the stream decodes them.
+	Typed mmdbtype.DataType
+}
+
+// networkStream reads the networks of a database one at a time, in address
+// order. IPv4 aliases in IPv6 databases are skipped, so every address is
+// seen at most once. A stream limited to scopes reads only the networks
+// within them, one scope after the other, and clips networks that contain a
+// scope to the scope.
+type networkStream struct {
+	db     *maxminddb.Reader
+	iter   *maxminddb.Networks
+	filter recordFilter
+	// scopes are the scopes not read yet and scope the current one, in the
+	// form used by db.
+	scopes []netip.Prefix
+	scope  netip.Prefix
+	typed  *mmdbValueDecoder
+	peeked *diffNetwork
+	err    error
+	// addresses counts the addresses of the networks consumed so far.
+	addresses familyCounts
+}
+
+// newNetworkStream returns a stream over the networks of db within scopes,
+// or over all networks if scopes is empty. scopes must come from
+// parseScopes. Records are reduced to the fields selected by filter.
+func newNetworkStream(db *maxminddb.Reader, filter recordFilter, scopes []netip.Prefix) *networkStream {
+	s := &networkStream{db: db, filter: filter, addresses: newFamilyCounts()}
+	if len(scopes) == 0 {
+		s.iter = db.Networks(maxminddb.SkipAliasedNetworks)
+	} else {
+		s.scopes = scopesFor(db, scopes)
+	}
+	return s
+}
+
+// nextNetwork advances to the next network, moving on to the next scope
+// when the current one is exhausted.
+func (s *networkStream) nextNetwork() bool {
+	for {
+		if s.iter != nil {
+			if s.iter.Next() {
+				return true
+			}
+			if s.iter.Err() != nil || len(s.scopes) == 0 {
+				return false
+			}
+		}
+		if len(s.scopes) == 0 {
+			return false
+		}
+		s.scope, s.scopes = s.scopes[0], s.scopes[1:]
+		s.iter = s.db.NetworksWithin(netipx.PrefixIPNet(s.scope), maxminddb.SkipAliasedNetworks)
+	}
+}
+
+// decodeTypes makes the stream also decode every record with its MMDB
+// types into diffNetwork.Typed.
+func (s *networkStream) decodeTypes() {
+	s.typed = &mmdbValueDecoder{}
+}
+
+// peek returns the next network without consuming it. It returns false at
+// the end of the database or after an error, see Err.
+func (s *networkStream) peek() (diffNetwork, bool) {
+	if s.peeked != nil {
+		return *s.peeked, true
+	}
+	if s.err != nil || !s.nextNetwork() {
+		return diffNetwork{}, false
+	}
+
+	var record interface{}
+	network, err := s.iter.Network(&record)
+	if err != nil {
+		s.err = err
+		return diffNetwork{}, false
+	}
+	prefix, ok := netipx.FromStdIPNet(network)
+	if !ok {
+		s.err = fmt.Errorf("invalid network %s", network)
+		return diffNetwork{}, false
+	}
+	if s.scope.IsValid() {
+		nr, sr := treeRange(netipx.RangeOfPrefix(prefix)), treeRange(netipx.RangeOfPrefix(s.scope))
+		if nr != sr && !sr.From().Less(nr.From()) && !nr.To().Less(sr.To()) {
+			// The network contains the whole scope.
+			prefix = s.scope
+		}
+	}
+	s.peeked = &diffNetwork{
+		Network: prefix,
+		Range:   treeRange(netipx.RangeOfPrefix(prefix)),
+		Record:  s.filter.apply(record),
+	}
+	if s.typed != nil {
+		if _, err := s.iter.Network(s.typed); err != nil {
+			s.err = err
+			return diffNetwork{}, false
+		}
+		s.peeked.Typed = s.typed.decodeTyped()
+	}
+	return *s.peeked, true
+}
+
+// next returns and consumes the next network.
+func (s *networkStream) next() (diffNetwork, bool) {
+	n, ok := s.peek()
+	s.peeked = nil
+	if ok {
+		s.addresses.add(treeFamily(n.Range), rangeSize(n.Range))
+	}
+	return n, ok
+}
+
+// Err returns the error that ended the stream, if any.
+func (s *networkStream) Err() error {
+	if s.err != nil {
+		return s.err
+	}
+	if s.iter == nil {
+		return nil
+	}
+	return s.iter.Err()
+}
+
+// diffNetworks merge-joins the networks of both databases in address order
+// and calls emit for every network that was added, removed or whose record
+// changed. Networks are matched by their exact position in the address
+// space, and only the current network of each side is held in memory.
+func diffNetworks(oldNets, newNets *networkStream, emit func(kind string, old, new diffNetwork) error) error {
+	for {
+		o, hasOld := oldNets.peek()
+		n, hasNew := newNets.peek()
+		if !hasOld && !hasNew {
+			break
+		}
+
+		var err error
+		switch {
+		case hasOld && hasNew && o.Range == n.Range:
+			oldNets.next()
+			newNets.next()
+			if !reflect.DeepEqual(o.Record, n.Record) {
+				err = emit(changeModified, o, n)
+			}
+		case !hasNew || (hasOld && rangeLess(o.Range, n.Range)):
+			oldNets.next()
+			err = emit(changeRemoved, o, diffNetwork{})
+		default:
+			newNets.next()
+			err = emit(changeAdded, diffNetwork{}, n)
+		}
+		if err != nil {
+			return err
+		}
+	}
+
+	if err := oldNets.Err(); err != nil {
+		return err
+	}
+	return newNets.Err()
+}
+
+// parseScopes parses the networks given to diff --range, in any format
+// accepted by import. It returns them as non-overlapping prefixes of an
+// IPv6 tree, with IPv4 in ::/96, in address order.
+func parseScopes(specs []string) ([]netip.Prefix, error) {
+	var prefixes []netip.Prefix
+	for _, spec := range specs {
+		r, warning, err := parseNetworkKey(spec)
+		if err != nil {
+			return nil, fmt.Errorf("invalid --range %q: %v", spec, err)
+		}
+		if warning != "" {
+			fmt.Fprintf(os.Stderr, "warn: --range: %s\n", warning)
+		}
+		prefixes = append(prefixes, treeRange(r).Prefixes()...)
+	}
+	sort.Slice(prefixes, func(i, j int) bool {
+		return rangeLess(netipx.RangeOfPrefix(prefixes[i]), netipx.RangeOfPrefix(prefixes[j]))
+	})
+
+	var scopes []netip.Prefix
+	for _, p := range prefixes {
+		if n := len(scopes); n > 0 && scopes[n-1].Overlaps(p) {
+			// Prefixes either nest or are disjoint, and the wider one
+			// sorts first.
+			continue
+		}
+		scopes = append(scopes, p)
+	}
+	return scopes, nil
+}
+
+// scopesFor converts scopes from parseScopes to the form db is read with:
+// IPv4 prefixes for the IPv4 subtree, and only those for an IPv4 database.
+func scopesFor(db *maxminddb.Reader, scopes []netip.Prefix) []netip.Prefix {
+	ipv4Tree := netip.PrefixFrom(netip.IPv6Unspecified(), 96)
+	var out []netip.Prefix
+	for _, p := range scopes {
+		switch {
+		case p.Bits() >= 96 && ipv4Tree.Contains(p.Addr()):
+			a := p.Addr().As16()
+			out = append(out, netip.PrefixFrom(netip.AddrFrom4([4]byte(a[12:])), p.Bits()-96))
+		case db.Metadata.IPVersion == 4:
+			if p.Contains(netip.IPv6Unspecified()) {
+				out = append(out, netip.PrefixFrom(netip.IPv4Unspecified(), 0))
+			}
+		default:
+			out = append(out, p)
+		}
+	}
+	return out
+}
+
+// rangeLess orders ranges by their first address, with the wider range
+// first when two start at the same address.
+func rangeLess(a, b netipx.IPRange) bool {
+	if a.From() != b.From() {
+		return a.From().Less(b.From())
+	}
+	return b.To().Less(a.To())
+}
+
+// treeToRange maps a range in the IPv4 subtree (::/96) of an IPv6 tree back
+// to IPv4, the inverse of treeRange.
+func treeToRange(r netipx.IPRange) netipx.IPRange {
+	from, to := r.From().As16(), r.To().As16()
+	for i := 0; i < 12; i++ {
+		if from[i] != 0 || to[i] != 0 {
+			return r
+		}
+	}
+	return netipx.IPRangeFrom(
+		netip.AddrFrom4([4]byte(from[12:])),
+		netip.AddrFrom4([4]byte(to[12:])),
+	)
+}
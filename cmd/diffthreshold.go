@@ -0,0 +1,180 @@
+package cmd
+
+import (
+	"fmt"
+	"math/big"
+	"reflect"
+	"strconv"
+	"strings"
+
+	"go4.org/netipx"
+)
+
+// exitThresholdExceeded is the exit status of diff when a threshold is
+// exceeded, so that CI can tell it apart from a failure to run.
+const exitThresholdExceeded = 3
+
+// Address families. Percentages are checked per family, as IPv6 networks are
+// so much larger that they would hide any change to IPv4 data.
+const (
+	familyIPv4 = "IPv4"
+	familyIPv6 = "IPv6"
+)
+
+var addressFamilies = []string{familyIPv4, familyIPv6}
+
+// familyCounts counts addresses per address family.
+type familyCounts map[string]*big.Int
+
+// newFamilyCounts returns zero counts for every family.
+func newFamilyCounts() familyCounts {
+	return familyCounts{familyIPv4: new(big.Int), familyIPv6: new(big.Int)}
+}
+
+// add adds n addresses to family.
+func (f familyCounts) add(family string, n *big.Int) {
+	f[family].Add(f[family], n)
+}
+
+// treeFamily returns the family of a range in an IPv6 tree, with IPv4 in
+// ::/96.
+func treeFamily(r netipx.IPRange) string {
+	if treeToRange(r).From().Is4() {
+		return familyIPv4
+	}
+	return familyIPv6
+}
+
+// networkFamily returns the family of a network as printed by diff.
+func networkFamily(network string) string {
+	if r, _, err := parseNetworkKey(network); err == nil && r.From().Is4() {
+		return familyIPv4
+	}
+	return familyIPv6
+}
+
+// fieldThreshold limits how much one field may change, either in networks
+// or, with Percent, in percent of the addresses of each family in the old
+// database.
+type fieldThreshold struct {
+	Path    string
+	Limit   float64
+	Percent bool
+	Spec    string
+
+	networks  int
+	addresses familyCounts
+}
+
+// parseFieldThreshold parses "path=N" or "path=N%".
+func parseFieldThreshold(spec string) (*fieldThreshold, error) {
+	path, limit, ok := strings.Cut(spec, "=")
+	path, limit = strings.TrimSpace(path), strings.TrimSpace(limit)
+	if !ok || path == "" || limit == "" {
+		return nil, fmt.Errorf("invalid field threshold %q, expected path=N or path=N%%", spec)
+	}
+	t := &fieldThreshold{Path: path, Spec: spec, addresses: newFamilyCounts()}
+	if strings.HasSuffix(limit, "%") {
+		t.Percent = true
+		limit = strings.TrimSuffix(limit, "%")
+	}
+	n, err := strconv.ParseFloat(limit, 64)
+	if err != nil || n < 0 {
+		return nil, fmt.Errorf("invalid field threshold %q, expected path=N or path=N%%", spec)
+	}
+	t.Limit = n
+	return t, nil
+}
+
+// diffThresholds checks the changes found by diff against the limits given
+// on the command line. Unset limits are nil.
+type diffThresholds struct {
+	MaxChangedPct *float64
+	MaxRemoved    *int
+	Fields        []*fieldThreshold
+
+	changed familyCounts
+	removed int
+}
+
+// newDiffThresholds returns thresholds with the given limits.
+func newDiffThresholds(maxChangedPct *float64, maxRemoved *int, fields []*fieldThreshold) *diffThresholds {
+	return &diffThresholds{
+		MaxChangedPct: maxChangedPct,
+		MaxRemoved:    maxRemoved,
+		Fields:        fields,
+		changed:       newFamilyCounts(),
+	}
+}
+
+// active reports whether any threshold is set.
+func (t *diffThresholds) active() bool {
+	return t.MaxChangedPct != nil || t.MaxRemoved != nil || len(t.Fields) > 0
+}
+
+// add counts a change with the old and new record it covers.
+func (t *diffThresholds) add(c diffChange, oldRec, newRec interface{}) {
+	family := networkFamily(c.Network)
+	t.changed.add(family, c.Addresses)
+	if c.Kind == changeRemoved {
+		t.removed++
+	}
+	for _, f := range t.Fields {
+		var from, to interface{}
+		if c.Kind != changeAdded {
+			from, _ = extractField(oldRec, f.Path)
+		}
+		if c.Kind != changeRemoved {
+			to, _ = extractField(newRec, f.Path)
+		}
+		if !reflect.DeepEqual(from, to) {
+			f.networks++
+			f.addresses.add(family, c.Addresses)
+		}
+	}
+}
+
+// check returns a description of every threshold that was exceeded. total
+// is the number of addresses per family in the old database; percentages are
+// checked for each family.
+func (t *diffThresholds) check(total familyCounts) []string {
+	var exceeded []string
+	if t.MaxChangedPct != nil {
+		for _, family := range addressFamilies {
+			if pct := percentOf(t.changed[family], total[family]); pct > *t.MaxChangedPct {
+				exceeded = append(exceeded, fmt.Sprintf("%.2f%% of %s addresses changed (%s of %s), limit --max-changed-pct %g",
+					pct, family, t.changed[family], total[family], *t.MaxChangedPct))
+			}
+		}
+	}
+	if t.MaxRemoved != nil && t.removed > *t.MaxRemoved {
+		exceeded = append(exceeded, fmt.Sprintf("%d networks removed, limit --max-removed %d", t.removed, *t.MaxRemoved))
+	}
+	for _, f := range t.Fields {
+		if f.Percent {
+			for _, family := range addressFamilies {
+				if pct := percentOf(f.addresses[family], total[family]); pct > f.Limit {
+					exceeded = append(exceeded, fmt.Sprintf("%s changed for %.2f%% of %s addresses (%s of %s), limit --max-field-change %s",
+						f.Path, pct, family, f.addresses[family], total[family], f.Spec))
+				}
+			}
+		} else if float64(f.networks) > f.Limit {
+			exceeded = append(exceeded, fmt.Sprintf("%s changed in %d networks, limit --max-field-change %s",
+				f.Path, f.networks, f.Spec))
+		}
+	}
+	return exceeded
+}
+
+// percentOf returns n as a percentage of total. Any change to an empty
+// database or family counts as 100%.
+func percentOf(n, total *big.Int) float64 {
+	if total.Sign() == 0 {
+		if n.Sign() == 0 {
+			return 0
+		}
+		return 100
+	}
+	pct, _ := new(big.Float).Quo(new(big.Float).SetInt(n), new(big.Float).SetInt(total)).Float64()
+	return pct * 100
+}
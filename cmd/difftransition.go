@@ -0,0 +1,221 @@
+package cmd
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"math/big"
+	"sort"
+	"text/tabwriter"
+)
+
+// transition is the movement of addresses and networks from one value of
+// the grouped field to another. A nil value means the field was absent, or
+// the network did not exist on that side.
+type transition struct {
+	From      interface{} `json:"from"`
+	To        interface{} `json:"to"`
+	Addresses *big.Int    `json:"addresses"`
+	Networks  int         `json:"networks"`
+}
+
+// valueChange is the net movement into and out of one value of the grouped
+// field.
+type valueChange struct {
+	Value           interface{} `json:"value"`
+	GainedAddresses *big.Int    `json:"gained_addresses"`
+	LostAddresses   *big.Int    `json:"lost_addresses"`
+	GainedNetworks  int         `json:"gained_networks"`
+	LostNetworks    int         `json:"lost_networks"`
+}
+
+// transitionMatrix counts how the value of one field moved between the old
+// and the new database, weighted by addresses and networks.
+type transitionMatrix struct {
+	path        string
+	transitions map[[2]string]*transition
+	values      map[string]*valueChange
+	// metadata lists the metadata changes, which are printed first.
+	metadata []fieldChange
+}
+
+// newTransitionMatrix returns an empty matrix for the dot-separated field
+// path.
+func newTransitionMatrix(path string) *transitionMatrix {
+	return &transitionMatrix{
+		path:        path,
+		transitions: map[[2]string]*transition{},
+		values:      map[string]*valueChange{},
+	}
+}
+
+// add counts a change of kind covering addresses addresses. Modified
+// networks whose grouped value did not change are not counted.
+func (m *transitionMatrix) add(kind string, oldRec, newRec interface{}, addresses *big.Int) {
+	var from, to interface{}
+	if kind != changeAdded {
+		from, _ = extractField(oldRec, m.path)
+	}
+	if kind != changeRemoved {
+		to, _ = extractField(newRec, m.path)
+	}
+	fromKey, toKey := transitionKey(from), transitionKey(to)
+	if fromKey == toKey {
+		return
+	}
+
+	t, ok := m.transitions[[2]string{fromKey, toKey}]
+	if !ok {
+		t = &transition{From: from, To: to, Addresses: new(big.Int)}
+		m.transitions[[2]string{fromKey, toKey}] = t
+	}
+	t.Addresses.Add(t.Addresses, addresses)
+	t.Networks++
+
+	if from != nil {
+		v := m.value(fromKey, from)
+		v.LostAddresses.Add(v.LostAddresses, addresses)
+		v.LostNetworks++
+	}
+	if to != nil {
+		v := m.value(toKey, to)
+		v.GainedAddresses.Add(v.GainedAddresses, addresses)
+		v.GainedNetworks++
+	}
+}
+
+// value returns the net counts for a value, creating them if needed.
+func (m *transitionMatrix) value(key string, val interface{}) *valueChange {
+	v, ok := m.values[key]
+	if !ok {
+		v = &valueChange{Value: val, GainedAddresses: new(big.Int), LostAddresses: new(big.Int)}
+		m.values[key] = v
+	}
+	return v
+}
+
+// sortedTransitions returns the transitions with the most addresses first.
+func (m *transitionMatrix) sortedTransitions() []transition {
+	out := make([]transition, 0, len(m.transitions))
+	for _, t := range m.transitions {
+		out = append(out, *t)
+	}
+	sort.Slice(out, func(i, j int) bool {
+		if c := out[i].Addresses.Cmp(out[j].Addresses); c != 0 {
+			return c > 0
+		}
+		if out[i].Networks != out[j].Networks {
+			return out[i].Networks > out[j].Networks
+		}
+		if a, b := transitionKey(out[i].From), transitionKey(out[j].From); a != b {
+			return a < b
+		}
+		return transitionKey(out[i].To) < transitionKey(out[j].To)
+	})
+	return out
+}
+
+// sortedValues returns the per-value counts with the most addresses moved
+// in or out first.
+func (m *transitionMatrix) sortedValues() []valueChange {
+	out := make([]valueChange, 0, len(m.values))
+	for _, v := range m.values {
+		out = append(out, *v)
+	}
+	moved := func(v valueChange) *big.Int {
+		return new(big.Int).Add(v.GainedAddresses, v.LostAddresses)
+	}
+	sort.Slice(out, func(i, j int) bool {
+		if c := moved(out[i]).Cmp(moved(out[j])); c != 0 {
+			return c > 0
+		}
+		return transitionKey(out[i].Value) < transitionKey(out[j].Value)
+	})
+	return out
+}
+
+// write prints the matrix as tables, or as JSON with asJSON. With top > 0
+// only the top rows of each table are printed.
+func (m *transitionMatrix) write(w io.Writer, asJSON bool, top int) error {
+	transitions := m.sortedTransitions()
+	values := m.sortedValues()
+	totalTransitions, totalValues := len(transitions), len(values)
+	if top > 0 && len(transitions) > top {
+		transitions = transitions[:top]
+	}
+	if top > 0 && len(values) > top {
+		values = values[:top]
+	}
+
+	if asJSON {
+		enc := json.NewEncoder(w)
+		enc.SetIndent("", "  ")
+		metadata := m.metadata
+		if metadata == nil {
+			metadata = []fieldChange{}
+		}
+		return enc.Encode(map[string]interface{}{
+			"metadata":          metadata,
+			"group_by":          m.path,
+			"total_transitions": totalTransitions,
+			"transitions":       transitions,
+			"total_values":      totalValues,
+			"values":            values,
+		})
+	}
+
+	if len(m.metadata) > 0 {
+		printMetadataChanges(w, m.metadata)
+		fmt.Fprintln(w)
+	}
+	if totalTransitions == 0 {
+		_, err := fmt.Fprintf(w, "No changes in %s\n", m.path)
+		return err
+	}
+
+	tw := tabwriter.NewWriter(w, 0, 0, 2, ' ', 0)
+	fmt.Fprintf(tw, "FROM\tTO\tADDRESSES\tNETWORKS\n")
+	for _, t := range transitions {
+		fmt.Fprintf(tw, "%s\t%s\t%s\t%d\n", displayValue(t.From), displayValue(t.To), t.Addresses, t.Networks)
+	}
+	if err := tw.Flush(); err != nil {
+		return err
+	}
+	if totalTransitions > len(transitions) {
+		fmt.Fprintf(w, "... %d more transitions\n", totalTransitions-len(transitions))
+	}
+
+	fmt.Fprintln(w)
+	tw = tabwriter.NewWriter(w, 0, 0, 2, ' ', 0)
+	fmt.Fprintf(tw, "VALUE\tGAINED ADDRESSES\tLOST ADDRESSES\tGAINED NETWORKS\tLOST NETWORKS\n")
+	for _, v := range values {
+		fmt.Fprintf(tw, "%s\t%s\t%s\t%d\t%d\n", displayValue(v.Value), v.GainedAddresses, v.LostAddresses, v.GainedNetworks, v.LostNetworks)
+	}
+	if err := tw.Flush(); err != nil {
+		return err
+	}
+	if totalValues > len(values) {
+		fmt.Fprintf(w, "... %d more values\n", totalValues-len(values))
+	}
+	return nil
+}
+
+// transitionKey identifies a field value; absent values have the empty key.
+func transitionKey(v interface{}) string {
+	if v == nil {
+		return ""
+	}
+	return compactJSON(v)
+}
+
+// displayValue prints strings as they are and other values as JSON.
+func displayValue(v interface{}) string {
+	switch t := v.(type) {
+	case nil:
+		return "(none)"
+	case string:
+		return t
+	default:
+		return compactJSON(v)
+	}
+}
@@ -0,0 +1,114 @@
+package cmd
+
+import (
+	"errors"
+	"fmt"
+	"os"
+
+	"github.com/maxmind/mmdbwriter"
+	"github.com/maxmind/mmdbwriter/inserter"
+	"github.com/maxmind/mmdbwriter/mmdbtype"
+	"go4.org/netipx"
+)
+
+// bogonNetworks are the special-purpose ranges removed by --exclude-bogons:
+// the non-global entries of the RFC 6890 special-purpose registries and the
+// documentation ranges. Ranges that mmdbwriter uses as IPv4 aliases are left
+// out, as they hold no data of their own; 2001::/23 contains the Teredo alias
+// 2001::/32, which mmdbwriter keeps when removing the block around it.
+var bogonNetworks = []string{
+	"0.0.0.0/8",          // "This network"
+	"10.0.0.0/8",         // Private use
+	"100.64.0.0/10",      // Shared address space
+	"127.0.0.0/8",        // Loopback
+	"169.254.0.0/16",     // Link local
+	"172.16.0.0/12",      // Private use
+	"192.0.0.0/24",       // IETF protocol assignments
+	"192.0.2.0/24",       // Documentation (TEST-NET-1)
+	"192.88.99.0/24",     // Deprecated 6to4 relay anycast
+	"192.168.0.0/16",     // Private use
+	"198.18.0.0/15",      // Benchmarking
+	"198.51.100.0/24",    // Documentation (TEST-NET-2)
+	"203.0.113.0/24",     // Documentation (TEST-NET-3)
+	"224.0.0.0/4",        // Multicast
+	"240.0.0.0/4",        // Reserved
+	"255.255.255.255/32", // Limited broadcast
+	"::/128",             // Unspecified address
+	"::1/128",            // Loopback
+	"64:ff9b:1::/48",     // Local-use IPv4/IPv6 translation
+	"100::/64",           // Discard-only
+	"2001::/23",          // IETF protocol assignments, incl. Teredo 2001::/32, benchmarking and ORCHID
+	"2001:db8::/32",      // Documentation
+	"3fff::/20",          // Documentation
+	"fc00::/7",           // Unique local
+	"fe80::/10",          // Link local
+	"ff00::/8",           // Multicast
+}
+
+// exclusion is a range removed from the tree after all layers are inserted.
+type exclusion struct {
+	Source string
+	Key    string
+	Range  netipx.IPRange
+}
+
+// loadExclusions reads the --exclude lists and, if bogons is set, appends the
+// built-in bogon list. Unlike import inputs, an invalid line is an error so
+// that no excluded network is silently kept.
+func loadExclusions(paths []string, bogons bool) ([]exclusion, error) {
+	var exclusions []exclusion
+	add := func(source, key string) error {
+		r, warning, err := parseNetworkKey(key)
+		if err != nil {
+			return fmt.Errorf("invalid exclusion %q in %s: %v", key, source, err)
+		}
+		if warning != "" {
+			fmt.Fprintf(os.Stderr, "warn: %s: %s\n", source, warning)
+		}
+		exclusions = append(exclusions, exclusion{Source: source, Key: key, Range: r})
+		return nil
+	}
+
+	for _, path := range paths {
+		lines, err := readListLines(path)
+		if err != nil {
+			return nil, err
+		}
+		for _, line := range lines {
+			if err := add(path, line); err != nil {
+				return nil, err
+			}
+		}
+	}
+	if bogons {
+		for _, network := range bogonNetworks {
+			if err := add("bogons", network); err != nil {
+				return nil, err
+			}
+		}
+	}
+	return exclusions, nil
+}
+
+// applyExclusion removes every address of ex from tree, splitting larger
+// networks around it. It returns the number of records that held data.
+// Reserved and aliased parts of the tree hold no data and are skipped.
+func applyExclusion(tree *mmdbwriter.Tree, ex exclusion) (int, error) {
+	removed := 0
+	remove := func(existing mmdbtype.DataType) (mmdbtype.DataType, error) {
+		if existing != nil {
+			removed++
+		}
+		return inserter.Remove(existing)
+	}
+
+	for _, network := range rangeIPNets(ex.Range) {
+		err := tree.InsertFunc(network, remove)
+		var reservedErr *mmdbwriter.ReservedNetworkError
+		var aliasedErr *mmdbwriter.AliasedNetworkError
+		if err != nil && !errors.As(err, &reservedErr) && !errors.As(err, &aliasedErr) {
+			return removed, err
+		}
+	}
+	return removed, nil
+}
@@ -0,0 +1,121 @@
+package cmd
+
+import (
+	"fmt"
+	"path/filepath"
+	"strings"
+
+	"github.com/maxmind/mmdbwriter"
+)
+
+// Values accepted by --ip.
+const (
+	ipModeV4   = "4"
+	ipModeV6   = "6"
+	ipModeAuto = "auto"
+)
+
+// importOutput is a database written by import. A split import writes one
+// IPv4 and one IPv6 database, every other import writes a single one.
+type importOutput struct {
+	Path     string
+	Version  int
+	Aliased  bool
+	Tree     *mmdbwriter.Tree
+	Inserted int
+}
+
+// detectFamilies reports whether any of the entries are IPv4 or IPv6
+// networks. IPv4-mapped keys count as IPv4.
+func detectFamilies(layers [][]importEntry) (hasV4, hasV6 bool) {
+	for _, entries := range layers {
+		for _, entry := range entries {
+			if entry.Range.From().Is4() {
+				hasV4 = true
+			} else {
+				hasV6 = true
+			}
+		}
+	}
+	return hasV4, hasV6
+}
+
+// planOutputs decides which databases to write for the --ip mode and the
+// address families found in the input:
+//
+//   - "4" and "6" write a single database of that version. IPv4 networks in
+//     an IPv6 database are stored in ::/96, and ::ffff:0:0/96 is aliased to
+//     them only if alias is set.
+//   - "auto" writes an IPv4 database if the input only holds IPv4 networks
+//     and an IPv6 database otherwise. If the input mixes both, IPv4 networks
+//     are stored in ::/96 and aliasing is enabled so that IPv4-mapped
+//     addresses (::ffff:0:0/96) find the same records, unless aliasing was
+//     explicitly disabled (aliasSet without alias).
+//   - split writes the IPv4 networks to an IPv4 database and the IPv6
+//     networks to an IPv6 database, named after out with "-ipv4" and
+//     "-ipv6" before the extension. Families absent from the input are not
+//     written.
+func planOutputs(mode, out string, split, alias, aliasSet, hasV4, hasV6 bool) []importOutput {
+	if split {
+		var outputs []importOutput
+		if hasV4 {
+			outputs = append(outputs, importOutput{Path: splitOutputPath(out, "ipv4"), Version: 4})
+		}
+		if hasV6 || !hasV4 {
+			outputs = append(outputs, importOutput{Path: splitOutputPath(out, "ipv6"), Version: 6, Aliased: alias})
+		}
+		return outputs
+	}
+
+	switch mode {
+	case ipModeV4:
+		return []importOutput{{Path: out, Version: 4}}
+	case ipModeAuto:
+		if hasV4 && !hasV6 {
+			return []importOutput{{Path: out, Version: 4}}
+		}
+		aliased := alias
+		if hasV4 && !aliasSet {
+			aliased = true
+		}
+		return []importOutput{{Path: out, Version: 6, Aliased: aliased}}
+	default:
+		return []importOutput{{Path: out, Version: 6, Aliased: alias}}
+	}
+}
+
+// outputFor returns the database an entry belongs in, or nil if the entry is
+// IPv6 and the only database is IPv4.
+func outputFor(outputs []importOutput, entry importEntry) *importOutput {
+	is4 := entry.Range.From().Is4()
+	if len(outputs) == 1 {
+		if outputs[0].Version == 4 && !is4 {
+			return nil
+		}
+		return &outputs[0]
+	}
+	for i := range outputs {
+		if (outputs[i].Version == 4) == is4 {
+			return &outputs[i]
+		}
+	}
+	return nil
+}
+
+// splitOutputPath inserts suffix before the extension of out, e.g.
+// "geo.mmdb" becomes "geo-ipv4.mmdb".
+func splitOutputPath(out, suffix string) string {
+	ext := filepath.Ext(out)
+	return fmt.Sprintf("%s-%s%s", strings.TrimSuffix(out, ext), suffix, ext)
+}
+
+// describeOutput returns how IPv4 networks are stored in output.
+func describeOutput(output importOutput) string {
+	if output.Version == 4 {
+		return "IPv4 database"
+	}
+	if output.Aliased {
+		return "IPv6 database, IPv4 in ::/96 aliased from ::ffff:0:0/96"
+	}
+	return "IPv6 database, IPv4 in ::/96"
+}
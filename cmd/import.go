@@ -1,11 +1,13 @@
 package cmd
 
 import (
+	"crypto/ed25519"
 	"encoding/json"
 	"fmt"
-	"net"
 	"os"
+	"strconv"
 	"strings"
+	"time"
 
 	"github.com/maxmind/mmdbwriter"
 	"github.com/maxmind/mmdbwriter/inserter"
@@ -15,17 +17,46 @@ import (
 
 // Flags for the import command.
 var (
-	inPath            string
+	inPaths           []string
+	inputFormat       string
 	outPath           string
-	ipVersion         int
+	ipMode            string
+	splitFamilies     bool
+	writeManifests    bool
+	importSignKeyPath string
 	recordSize        int
 	mergeStrategyName string
 	alias6to4         bool
 	disallowReserved  bool
 	title             string
 	description       string
+	descriptions      map[string]string
+	languages         []string
+	buildEpoch        int64
+	metadataPath      string
+	overlapPolicy     string
+	conflictsPath     string
+	strictImport      bool
+	reportPath        string
+	nullMode          string
+	mergePolicyPath   string
+	listRecord        string
+	excludePaths      []string
+	excludeBogons     bool
+
+	// mergePolicyStrategy is the inserter compiled from --merge-policy.
+	mergePolicyStrategy inserter.FuncGenerator
 )
 
+// importMetadata holds the metadata written to the .mmdb file. It can be
+// loaded from the file given with --metadata and overridden by flags.
+type importMetadata struct {
+	DatabaseType string            `json:"database_type"`
+	Description  map[string]string `json:"description"`
+	Languages    []string          `json:"languages"`
+	BuildEpoch   int64             `json:"build_epoch"`
+}
+
 // importCmd represents the "import" command.
 var importCmd = &cobra.Command{
 	Use:   "import",
@@ -54,24 +85,200 @@ The import command expects JSON in this format:
   }
 }
 
+Records may be any JSON value, not just objects. For lookup tables that
+map networks to plain values this is valid as well:
+
+{
+  "1.2.3.0/24": "tor-exit",
+  "5.6.7.0/24": ["cdn", "anycast"]
+}
+
+JSON null values are handled according to --null:
+  empty   Store an empty string (the default)
+  omit    Drop the key (or array element); a null record is skipped
+  error   Reject the entry as skipped_invalid
+
 Each key must be:
-  • A CIDR block, e.g. "1.2.3.0/24"
+  • A CIDR block, e.g. "1.2.3.0/24", "1.2.3.0/255.255.255.0" or
+    "1.2.3.0 255.255.255.0"
   • A single IP address, e.g. "8.8.8.8"
-  • Or an IP range, e.g. "1.2.3.0-1.2.3.255"
+  • Or an IP range, e.g. "1.2.3.0-1.2.3.255" or "1.2.3.0 - 1.2.3.255"
+
+Addresses may also be written as decimal or hex integers, e.g.
+"16909056-16909311" or "0x01020300-0x010203ff", and IPv4-mapped IPv6
+addresses such as "::ffff:1.2.3.4" are treated as IPv4. A CIDR block with
+host bits set (e.g. "1.2.3.4/24") is masked to its network with a warning.
 
 ───────────────────────────────
  OPTIONS OVERVIEW
 ───────────────────────────────
 Flags available for customization:
 
-  --in, -i                 Input JSON file path
+  --in, -i                 Input file path, repeatable (see LAYERED IMPORT)
+  --format                 Default input format: json, ndjson, list, csv
+                           [default: json]
+  --record                 JSON record template for list inputs
   --out, -o                Output .mmdb file path
-  --ip                     IP version (4 or 6) [default: 6]
+  --ip                     IP version (4, 6 or auto) [default: 6]
+  --split                  Write separate IPv4 and IPv6 databases
   --size                   Record size (24, 28, or 32) [default: 32]
   --merge                  Merge strategy for duplicate entries
-                           Options: none, toplevel, recurse
+                           Options: none, toplevel, recurse, policy
+  --merge-policy           JSON file with merge rules per field path
+                           (implies --merge policy)
   --alias-6to4             Enable IPv6 to IPv4 aliasing (for hybrid DBs)
   --disallow-reserved       Skip reserved IP blocks (e.g. 127.0.0.0/8)
+  --exclude                List of CIDRs and ranges to remove from the
+                           database, repeatable
+  --exclude-bogons         Remove special-purpose and documentation ranges
+  --title, -t              Database type written to the metadata
+  --description, -d        English description written to the metadata
+  --descriptions           Descriptions per language
+                           (e.g. en=Threats,de=Bedrohungen)
+  --languages              Languages listed in the metadata [default: en]
+  --build-epoch            Fixed build time as a Unix timestamp
+  --metadata               JSON file with database_type, description,
+                           languages and build_epoch
+  --overlap                Precedence for overlapping networks
+                           Options: specific, file, error [default: specific]
+  --conflicts              Write every overlapping pair and its resolution
+                           to a JSON report
+  --null                   Handling of JSON null values
+                           Options: omit, empty, error [default: empty]
+  --strict                 Fail on the first invalid, reserved or failed entry
+  --report                 Write counts and every rejected key with its
+                           reason to a JSON report
+  --manifest               Write <out>.manifest.json and <out>.sha256
+  --sign-key               Ed25519 private key to write a detached
+                           signature to <out>.sig (see "mmdbio sign")
+
+───────────────────────────────
+📄 PLAIN LISTS
+───────────────────────────────
+With --format list each input is a text file with one CIDR, IP or range
+per line. Blank lines and comments starting with #, ; or // are ignored:
+
+  # Tor exit nodes
+  185.220.100.0/22
+  192.42.116.16-192.42.116.31   ; relay family
+
+Every network gets the record given with --record. In string values,
+{{name}} is replaced by the file name without extension and {{file}} by
+the file name, so one template can tag networks by the list they came
+from [default: {"source": "{{name}}"}]. Overlapping networks from
+different lists are combined with the merge strategy, e.g. a merge policy
+with "union" rules.
+
+───────────────────────────────
+📊 CSV
+───────────────────────────────
+With --format csv each input is a CSV file with a header row. The column
+named "network", or else the first column, holds the key and every other
+column a field of the record. Dots in a column name nest the field:
+
+  network,country.iso_code,asn,is_proxy
+  1.2.3.0/24,DE,13335,false
+
+gives {"country": {"iso_code": "DE"}, "asn": 13335, "is_proxy": false}.
+Empty cells are left out, and cells holding a JSON number, true or false
+are stored as such; everything else is a string.
+
+───────────────────────────────
+🚫 EXCLUSIONS
+───────────────────────────────
+--exclude takes a file in the list format above and removes every address
+it lists from the finished database, whichever layer inserted it. Larger
+networks are split around the excluded space, so excluding 10.1.0.0/16
+from a record for 10.0.0.0/8 leaves the rest of 10.0.0.0/8 in place. An
+invalid line in an exclusion list aborts the import.
+
+--exclude-bogons adds a built-in list of the special-purpose ranges from
+RFC 6890 (private use, loopback, link local, shared address space,
+multicast, benchmarking, etc.) and the documentation ranges
+(192.0.2.0/24, 198.51.100.0/24, 203.0.113.0/24, 2001:db8::/32, 3fff::/20).
+
+Unlike --disallow-reserved, which only rejects inserts into mmdbwriter's
+reserved networks, exclusions apply to any range and never fail an entry.
+
+───────────────────────────────
+ IPv4 AND IPv6
+───────────────────────────────
+--ip 4 writes an IPv4 database and rejects IPv6 networks as
+insert_failed. --ip 6 writes an IPv6 database in which IPv4 networks are
+stored in ::/96, where MaxMind readers look up IPv4 addresses; with
+--alias-6to4, IPv4-mapped (::ffff:0:0/96), 6to4 (2002::/16) and Teredo
+(2001::/32) addresses are aliased to them.
+
+--ip auto detects the families in the input:
+  IPv4 only   An IPv4 database is written
+  IPv6 only   An IPv6 database is written
+  Both        An IPv6 database with IPv4 in ::/96 is written, and aliasing
+              is enabled so that ::ffff:0:0/96 lookups find the same
+              records (unless --alias-6to4=false is given)
+
+IPv4-mapped keys such as "::ffff:1.2.3.0/120" always count as IPv4.
+
+--split implies --ip auto and writes IPv4 networks to <out>-ipv4.mmdb and
+IPv6 networks to <out>-ipv6.mmdb, skipping a family with no networks.
+
+───────────────────────────────
+ PROVENANCE
+───────────────────────────────
+--manifest writes <out>.manifest.json next to each output database. It
+records the tool version, the metadata and build epoch, the SHA-256 of
+every input layer, metadata file, merge policy and exclusion list, the
+value of every flag, the outcome counts and per-layer summary, the number
+of overlapping pairs, and the record size, node count and SHA-256 of the
+output. A matching <out>.sha256 file in sha256sum format is written as
+well, so "sha256sum -c out.mmdb.sha256" verifies the database.
+
+--sign-key signs each output with an Ed25519 key, the same as running
+"mmdbio sign" afterwards. The manifest then records the fingerprint of
+the signing key, and "mmdbio verify --pubkey" checks the signature.
+
+───────────────────────────────
+ LAYERED IMPORT
+───────────────────────────────
+--in may be given several times. Inputs are applied in order, so later
+layers take precedence over earlier ones. Each --in is either a plain path
+or a spec with per-layer options:
+
+  --in "file=fixes.ndjson,format=ndjson,merge=recurse,namespace=ours"
+
+  file        Input file path, or a glob matching several files
+  format      json, ndjson (one import-format object per line), list or csv
+  merge       none, toplevel or recurse (defaults to --merge)
+  namespace   Nest the layer's records under this top-level field
+
+A provenance summary of how many networks each layer touched is printed
+after a layered import and included in --report.
+
+───────────────────────────────
+ MERGE POLICY
+───────────────────────────────
+--merge-policy compiles per-field merge rules into a custom merge
+strategy, used wherever the merge strategy is "policy":
+
+{
+  "default": "last",
+  "fields": {
+    "tags": "union",
+    "threat_score": "max",
+    "first_seen": "first",
+    "hits": "sum"
+  }
+}
+
+  last      The new value replaces the existing one
+  first     The existing value is kept
+  recurse   Maps are merged field by field (the rule for unlisted maps)
+  union     Arrays are combined without duplicates
+  max, min  The larger or smaller number is kept
+  sum       Numbers are added together; a sum that does not fit the
+            integer type of its values fails the entry
+
+Fields are dot-separated paths (e.g. "threat.score"). "default" applies to
+unlisted values that are not both maps and is either last or first.
 
 ───────────────────────────────
  BEHIND THE SCENES
@@ -82,6 +289,20 @@ Internally, this command:
   3. Inserts each CIDR or range into a mmdbwriter tree.
   4. Serializes that tree into a valid .mmdb file.
 
+When networks overlap (e.g. a /16 and a /24 inside it), --overlap decides
+which record takes precedence for the shared addresses:
+  specific   More specific networks are inserted last and win
+  file       Entries later in the input file win
+  error      Abort the import if any networks overlap
+With --merge toplevel or recurse the records are merged in that order
+instead of replaced.
+
+Records are inserted in a well-defined order, so identical input and
+metadata always produce a byte-identical .mmdb file. The build epoch is
+taken from --build-epoch, then the --metadata file, then the
+SOURCE_DATE_EPOCH environment variable, and defaults to the current time.
+An explicit build epoch of 0 is kept.
+
 ───────────────────────────────
  EXAMPLES
 ───────────────────────────────
@@ -110,6 +331,30 @@ $ mmdbio import \
   --ip 6 \
   --alias-6to4
 
+Import mixed data into separate IPv4 and IPv6 databases
+---------------------------------------------------------
+$ mmdbio import \
+  --in all_data.json \
+  --out geo.mmdb \
+  --split
+
+Layered import (vendor feed, corrections, customer overrides)
+---------------------------------------------------------------
+$ mmdbio import \
+  --in vendor.json \
+  --in "file=corrections.ndjson,format=ndjson,merge=recurse" \
+  --in "file=customer.json,merge=recurse,namespace=customer" \
+  --out production.mmdb
+
+Build from blocklists, tagging each network with its list name
+----------------------------------------------------------------
+$ mmdbio import \
+  --format list \
+  --in "lists/*.txt" \
+  --record '{"category": ["{{name}}"]}' \
+  --merge-policy union.json \
+  --out blocklists.mmdb
+
 Import and skip reserved IPs
 -------------------------------
 $ mmdbio import \
@@ -117,19 +362,43 @@ $ mmdbio import \
   --out filtered.mmdb \
   --disallow-reserved
 
+Reproducible build with multi-language metadata
+-------------------------------------------------
+$ SOURCE_DATE_EPOCH=1700000000 mmdbio import \
+  --in dataset.json \
+  --out threats.mmdb \
+  --title Threat-DB \
+  --languages en,de \
+  --descriptions en="Threat data",de="Bedrohungsdaten"
+
 ───────────────────────────────
 🔍  OUTPUT
 ───────────────────────────────
 Upon successful import, you’ll see:
    Successfully wrote 2048 entries to ./output.mmdb
+   inserted: 2048 (merged: 3) | skipped invalid: 1 | skipped reserved: 0 |
+   skipped null: 0 | insert failed: 0 | partial: 0
+
+Only entries that were actually written are counted as inserted; merged
+entries are inserted entries that were merged with data already in the
+tree by --merge toplevel, recurse or policy. With --merge none an
+overlapping entry replaces the existing data and is not counted as merged.
+Rejected entries are reported as skipped_invalid (unparseable key),
+skipped_reserved (inside a reserved network with --disallow-reserved) or
+insert_failed. A range that expands to several prefixes of which only some
+could be written is reported as partial_insert, with the written prefixes
+listed in --report. With --strict the import stops with a non-zero exit code on
+the first rejected entry and no .mmdb file is written.
 
 ───────────────────────────────
   NOTES
 ───────────────────────────────
 • The output .mmdb file can be queried with any MaxMind-compatible reader.
 • Nested maps and arrays are supported (automatically converted).
-• Duplicate ranges are handled according to the --merge flag.
-• For debugging invalid entries, warnings are printed to stderr.
+• With a namespace, non-object records are nested under the namespace field.
+• Duplicate ranges are handled according to the --merge and --overlap flags.
+• For debugging invalid entries, warnings are printed to stderr, and --report
+  lists every rejected key with its reason.
 
 ───────────────────────────────
   EXAMPLE JSON (IPv6)
@@ -149,7 +418,7 @@ Upon successful import, you’ll see:
 `,
 	RunE: func(cmd *cobra.Command, args []string) error {
 		// Validate input and output
-		if inPath == "" {
+		if len(inPaths) == 0 {
 			return fmt.Errorf("--in is required")
 		}
 		if outPath == "" {
@@ -157,8 +426,14 @@ Upon successful import, you’ll see:
 		}
 
 		// Validate IP version
-		if ipVersion != 4 && ipVersion != 6 {
-			return fmt.Errorf("--ip must be 4 or 6")
+		if ipMode != ipModeV4 && ipMode != ipModeV6 && ipMode != ipModeAuto {
+			return fmt.Errorf("--ip must be 4, 6 or auto")
+		}
+		if splitFamilies {
+			if cmd.Flags().Changed("ip") && ipMode != ipModeAuto {
+				return fmt.Errorf("--split requires --ip auto")
+			}
+			ipMode = ipModeAuto
 		}
 
 		// Validate record size
@@ -167,121 +442,458 @@ Upon successful import, you’ll see:
 		}
 
 		// Select merge strategy
-		var mergeStrategy inserter.FuncGenerator
-		switch mergeStrategyName {
-		case "none":
-			mergeStrategy = inserter.ReplaceWith
-		case "toplevel":
-			mergeStrategy = inserter.TopLevelMergeWith
-		case "recurse":
-			mergeStrategy = inserter.DeepMergeWith
-		default:
-			return fmt.Errorf("--merge must be one of: none, toplevel, recurse")
+		if mergePolicyPath != "" {
+			strategy, err := loadMergePolicy(mergePolicyPath)
+			if err != nil {
+				return err
+			}
+			mergePolicyStrategy = strategy
+			if !cmd.Flags().Changed("merge") {
+				mergeStrategyName = "policy"
+			}
+		}
+		if _, err := mergeStrategyFor(mergeStrategyName); err != nil {
+			return fmt.Errorf("--%v", err)
 		}
 
-		// Open input file
-		file, err := os.Open(inPath)
-		if err != nil {
-			return fmt.Errorf("failed to open input: %v", err)
+		// Validate null handling
+		if nullMode != nullOmit && nullMode != nullEmpty && nullMode != nullError {
+			return fmt.Errorf("--null must be one of: omit, empty, error")
 		}
-		defer file.Close()
 
-		// Parse JSON into map[string]map[string]interface{}
-		data := make(map[string]map[string]interface{})
-		if err := json.NewDecoder(file).Decode(&data); err != nil {
-			return fmt.Errorf("failed to parse JSON: %v", err)
+		// Validate overlap policy
+		if overlapPolicy != overlapSpecific && overlapPolicy != overlapFile && overlapPolicy != overlapError {
+			return fmt.Errorf("--overlap must be one of: specific, file, error")
 		}
 
-		if len(data) == 0 {
-			return fmt.Errorf("no records found in %s", inPath)
+		// Resolve the input layers
+		var layers []importLayer
+		for _, spec := range inPaths {
+			specLayers, err := parseLayerSpec(spec, inputFormat, mergeStrategyName)
+			if err != nil {
+				return err
+			}
+			for _, layer := range specLayers {
+				if _, err := mergeStrategyFor(layer.Merge); err != nil {
+					return fmt.Errorf("%s: %v", layer.Path, err)
+				}
+			}
+			layers = append(layers, specLayers...)
 		}
 
-		// Create mmdb writer tree
-		tree, err := mmdbwriter.New(mmdbwriter.Options{
-			DatabaseType:            title,
-			Description:             map[string]string{"en": description},
-			Languages:               []string{"en"},
-			IPVersion:               ipVersion,
-			RecordSize:              recordSize,
-			Inserter:                mergeStrategy,
-			DisableIPv4Aliasing:     !alias6to4,
-			IncludeReservedNetworks: !disallowReserved,
-		})
+		var signingKey ed25519.PrivateKey
+		if importSignKeyPath != "" {
+			key, err := loadPrivateKey(importSignKeyPath)
+			if err != nil {
+				return err
+			}
+			signingKey = key
+		}
+
+		exclusions, err := loadExclusions(excludePaths, excludeBogons)
 		if err != nil {
-			return fmt.Errorf("failed to create mmdb writer: %v", err)
+			return err
 		}
 
-		// Insert records
-		count := 0
-		for key, fields := range data {
-			record := mmdbtype.Map{}
-			for field, val := range fields {
-				mmdbVal, err := convertToMMDBType(val)
+		meta, err := resolveImportMetadata(cmd)
+		if err != nil {
+			return err
+		}
+
+		acct := &importAccounting{}
+		// rejected records a problem with an entry, which aborts the import in strict mode
+		rejected := func(entry importEntry, reason string, err error, written ...string) error {
+			acct.reject(entry, reason, err, written)
+			if !strictImport {
+				return nil
+			}
+			if reportPath != "" {
+				if err := acct.writeReport(reportPath); err != nil {
+					return fmt.Errorf("failed to write report: %v", err)
+				}
+			}
+			return fmt.Errorf("strict mode: %s: %s: %v", reason, entry.Key, err)
+		}
+
+		var conflicts []overlapConflict
+		total := 0
+		layerEntries := make([][]importEntry, len(layers))
+		for i, layer := range layers {
+			acct.Layers = append(acct.Layers, layerStats{
+				Source:    layer.Path,
+				Format:    layer.Format,
+				Merge:     layer.Merge,
+				Namespace: layer.Namespace,
+			})
+			stats := &acct.Layers[i]
+
+			// Parse the input, keeping the order of the keys in the file
+			data, err := readEntries(layer.Path, layer.Format, listRecord)
+			if err != nil {
+				return err
+			}
+			if len(data) == 0 {
+				fmt.Fprintf(os.Stderr, "warn: no records found in %s\n", layer.Path)
+			}
+			stats.Entries = len(data)
+			total += len(data)
+
+			// Resolve the network of each key
+			var entries []importEntry
+			for _, entry := range data {
+				r, warning, err := parseNetworkKey(entry.Key)
+				if warning != "" {
+					fmt.Fprintf(os.Stderr, "warn: %s: %s\n", entry.Source, warning)
+				}
 				if err != nil {
-					return fmt.Errorf("failed to convert field %q: %v", field, err)
+					stats.Rejected++
+					if err := rejected(entry, reasonInvalid, err); err != nil {
+						return err
+					}
+					continue
+				}
+				entry.Range = r
+				entries = append(entries, entry)
+			}
+
+			// Decide precedence for overlapping networks within the layer
+			entries = orderEntries(entries, overlapPolicy)
+			layerConflicts := findOverlaps(entries, overlapPolicy, layer.Merge)
+			if len(layerConflicts) > 0 {
+				if overlapPolicy == overlapError {
+					c := layerConflicts[0]
+					return fmt.Errorf("%s: %d overlapping network pairs found, first: %s and %s overlap at %s",
+						layer.Path, len(layerConflicts), c.First, c.Second, c.Overlap)
 				}
-				record[mmdbtype.String(field)] = mmdbVal
+				fmt.Fprintf(os.Stderr, "warn: %s: %d overlapping network pairs resolved by %q policy\n",
+					layer.Path, len(layerConflicts), overlapPolicy)
+			}
+			conflicts = append(conflicts, layerConflicts...)
+			layerEntries[i] = entries
+		}
+
+		// Create a mmdb writer tree for each output database
+		hasV4, hasV6 := detectFamilies(layerEntries)
+		outputs := planOutputs(ipMode, outPath, splitFamilies, alias6to4, cmd.Flags().Changed("alias-6to4"), hasV4, hasV6)
+		for i := range outputs {
+			outputs[i].Tree, err = mmdbwriter.New(mmdbwriter.Options{
+				BuildEpoch:              meta.BuildEpoch,
+				DatabaseType:            meta.DatabaseType,
+				Description:             meta.Description,
+				Languages:               meta.Languages,
+				IPVersion:               outputs[i].Version,
+				RecordSize:              recordSize,
+				DisableIPv4Aliasing:     !outputs[i].Aliased,
+				IncludeReservedNetworks: !disallowReserved,
+			})
+			if err != nil {
+				return fmt.Errorf("failed to create mmdb writer: %v", err)
 			}
+		}
 
-			// Determine if it's a CIDR or range
-			if strings.Contains(key, "-") {
-				parts := strings.Split(key, "-")
-				if len(parts) != 2 {
-					fmt.Fprintf(os.Stderr, "warn: invalid range %s\n", key)
+		// Insert records
+		for i, layer := range layers {
+			mergeStrategy, _ := mergeStrategyFor(layer.Merge)
+			stats := &acct.Layers[i]
+			for _, entry := range layerEntries[i] {
+				record, err := convertToMMDBType(entry.Record, nullMode)
+				if err != nil {
+					stats.Rejected++
+					if err := rejected(entry, reasonInvalid, err); err != nil {
+						return err
+					}
 					continue
 				}
-				startIP := net.ParseIP(parts[0])
-				endIP := net.ParseIP(parts[1])
-				if startIP == nil || endIP == nil {
-					fmt.Fprintf(os.Stderr, "warn: invalid IPs in %s\n", key)
+				if record == nil {
+					// A null record with --null omit has nothing to insert
+					acct.Counts.SkippedNull++
 					continue
 				}
-				if err := tree.InsertRange(startIP, endIP, record); err != nil {
-					fmt.Fprintf(os.Stderr, "warn: could not insert range %s\n", key)
+				if layer.Namespace != "" {
+					record = mmdbtype.Map{mmdbtype.String(layer.Namespace): record}
 				}
-			} else {
-				_, network, err := net.ParseCIDR(key)
-				if err != nil {
-					// maybe it's a single IP without /mask
-					if ipVersion == 6 && strings.Contains(key, ":") {
-						key += "/128"
-					} else {
-						key += "/32"
+
+				output := outputFor(outputs, entry)
+				if output == nil {
+					stats.Rejected++
+					if err := rejected(entry, reasonFailed, fmt.Errorf("IPv6 network in an IPv4 database")); err != nil {
+						return err
 					}
-					_, network, err = net.ParseCIDR(key)
-					if err != nil {
-						fmt.Fprintf(os.Stderr, "warn: invalid network %s\n", key)
-						continue
+					continue
+				}
+
+				res, err := insertEntry(output.Tree, entry, record, mergeStrategy)
+				stats.Networks += res.Networks
+				if err != nil {
+					stats.Rejected++
+					if err := rejected(entry, res.Reason, err, res.Written...); err != nil {
+						return err
 					}
+					continue
 				}
-				if err := tree.Insert(network, record); err != nil {
-					fmt.Fprintf(os.Stderr, "warn: could not insert %s\n", key)
+				acct.Counts.Inserted++
+				output.Inserted++
+				stats.Inserted++
+				// With --merge none an overlapping entry replaced the
+				// existing data, which is not a merge
+				if res.Overlapped && layer.Merge != "none" {
+					acct.Counts.Merged++
+					stats.Merged++
 				}
 			}
-			count++
 		}
 
-		// Write mmdb file
-		outFile, err := os.Create(outPath)
-		if err != nil {
-			return fmt.Errorf("failed to create output: %v", err)
+		// Remove excluded networks, splitting larger networks around them
+		for _, output := range outputs {
+			for _, ex := range exclusions {
+				if output.Version == 4 && !ex.Range.From().Is4() {
+					continue
+				}
+				removed, err := applyExclusion(output.Tree, ex)
+				if err != nil {
+					return fmt.Errorf("failed to exclude %s from %s: %v", ex.Key, ex.Source, err)
+				}
+				acct.Excluded += removed
+			}
+		}
+
+		if conflictsPath != "" {
+			if err := writeConflictReport(conflictsPath, overlapPolicy, conflicts); err != nil {
+				return fmt.Errorf("failed to write conflict report: %v", err)
+			}
+		}
+		if reportPath != "" {
+			if err := acct.writeReport(reportPath); err != nil {
+				return fmt.Errorf("failed to write report: %v", err)
+			}
+		}
+		if total == 0 {
+			return fmt.Errorf("no records found in %s", strings.Join(inPaths, ", "))
 		}
-		defer outFile.Close()
 
-		if _, err := tree.WriteTo(outFile); err != nil {
-			return fmt.Errorf("failed to write mmdb: %v", err)
+		// Write mmdb files
+		for _, output := range outputs {
+			if err := writeTree(output.Tree, output.Path, meta.BuildEpoch); err != nil {
+				return err
+			}
 		}
 
-		fmt.Fprintf(os.Stderr, "✅ Successfully wrote %d entries to %s\n", count, outPath)
+		if signingKey != nil {
+			for _, output := range outputs {
+				if err := signFile(output.Path, output.Path+signatureSuffix, signingKey); err != nil {
+					return err
+				}
+			}
+		}
+
+		if writeManifests {
+			manifest, err := newImportManifest(cmd, meta, layers, acct, len(conflicts))
+			if err != nil {
+				return err
+			}
+			if signingKey != nil {
+				manifest.SigningKey = keyFingerprint(signingKey.Public().(ed25519.PublicKey))
+			}
+			for _, output := range outputs {
+				if err := writeManifest(manifest, output); err != nil {
+					return err
+				}
+			}
+		}
+
+		for _, output := range outputs {
+			fmt.Fprintf(os.Stderr, "✅ Successfully wrote %d entries to %s\n", output.Inserted, output.Path)
+			if ipMode == ipModeAuto || splitFamilies {
+				fmt.Fprintf(os.Stderr, "   %s\n", describeOutput(output))
+			}
+		}
+		fmt.Fprintln(os.Stderr, "  ", acct.summary())
+		if len(exclusions) > 0 {
+			fmt.Fprintf(os.Stderr, "   excluded: %d ranges, removed data from %d networks\n", len(exclusions), acct.Excluded)
+		}
+		if len(layers) > 1 {
+			printLayerSummary(acct.Layers)
+		}
 		return nil
 	},
 }
 
-// convertToMMDBType recursively converts interface{} into mmdbtype.DataType
-func convertToMMDBType(value interface{}) (mmdbtype.DataType, error) {
+// newImportManifest collects the parts of the build manifest that are
+// shared by every output database.
+func newImportManifest(
+	cmd *cobra.Command,
+	meta importMetadata,
+	layers []importLayer,
+	acct *importAccounting,
+	overlaps int,
+) (buildManifest, error) {
+	manifest := buildManifest{
+		Tool:         rootCmd.Name(),
+		Version:      rootCmd.Version,
+		Metadata:     meta,
+		Flags:        flagValues(cmd),
+		Counts:       acct.Counts,
+		Excluded:     acct.Excluded,
+		Layers:       acct.Layers,
+		OverlapCount: overlaps,
+	}
+
+	for _, layer := range layers {
+		file, err := describeFile("", layer.Path)
+		if err != nil {
+			return manifest, err
+		}
+		manifest.Inputs = append(manifest.Inputs, manifestInput{
+			manifestFile: file,
+			Format:       layer.Format,
+			Merge:        layer.Merge,
+			Namespace:    layer.Namespace,
+		})
+	}
+
+	var files [][2]string
+	if metadataPath != "" {
+		files = append(files, [2]string{"metadata", metadataPath})
+	}
+	if mergePolicyPath != "" {
+		files = append(files, [2]string{"merge_policy", mergePolicyPath})
+	}
+	for _, path := range excludePaths {
+		files = append(files, [2]string{"exclude", path})
+	}
+	for _, f := range files {
+		file, err := describeFile(f[0], f[1])
+		if err != nil {
+			return manifest, err
+		}
+		manifest.Files = append(manifest.Files, file)
+	}
+	return manifest, nil
+}
+
+// writeTree writes tree to a new .mmdb file at path. buildEpoch is the
+// build epoch the tree was created with, so that 0 can be kept.
+func writeTree(tree *mmdbwriter.Tree, path string, buildEpoch int64) error {
+	outFile, err := os.Create(path)
+	if err != nil {
+		return fmt.Errorf("failed to create output: %v", err)
+	}
+	defer outFile.Close()
+
+	if _, err := tree.WriteTo(outFile); err != nil {
+		return fmt.Errorf("failed to write mmdb: %v", err)
+	}
+	if err := outFile.Close(); err != nil {
+		return fmt.Errorf("failed to write mmdb: %v", err)
+	}
+	if buildEpoch == 0 {
+		if err := clearBuildEpoch(path); err != nil {
+			return fmt.Errorf("failed to write build epoch: %v", err)
+		}
+	}
+	return nil
+}
+
+// resolveImportMetadata combines the --metadata file, the metadata flags and
+// SOURCE_DATE_EPOCH. Flags that were set explicitly take precedence over the
+// file, and the file takes precedence over the flag defaults.
+func resolveImportMetadata(cmd *cobra.Command) (importMetadata, error) {
+	meta := importMetadata{
+		DatabaseType: title,
+		Description:  map[string]string{},
+		Languages:    languages,
+	}
+
+	// An explicit build epoch of 0 is kept; only an unset one defaults
+	epochSet := false
+	if metadataPath != "" {
+		raw, err := os.ReadFile(metadataPath)
+		if err != nil {
+			return meta, fmt.Errorf("failed to read metadata file: %v", err)
+		}
+		var fileMeta importMetadata
+		if err := json.Unmarshal(raw, &fileMeta); err != nil {
+			return meta, fmt.Errorf("failed to parse metadata file: %v", err)
+		}
+		var fileEpoch struct {
+			BuildEpoch *int64 `json:"build_epoch"`
+		}
+		if err := json.Unmarshal(raw, &fileEpoch); err != nil {
+			return meta, fmt.Errorf("failed to parse metadata file: %v", err)
+		}
+		if fileMeta.DatabaseType != "" && !cmd.Flags().Changed("title") {
+			meta.DatabaseType = fileMeta.DatabaseType
+		}
+		for lang, desc := range fileMeta.Description {
+			meta.Description[lang] = desc
+		}
+		if len(fileMeta.Languages) > 0 && !cmd.Flags().Changed("languages") {
+			meta.Languages = fileMeta.Languages
+		}
+		if fileEpoch.BuildEpoch != nil {
+			meta.BuildEpoch, epochSet = *fileEpoch.BuildEpoch, true
+		}
+	}
+
+	for lang, desc := range descriptions {
+		meta.Description[lang] = desc
+	}
+	if cmd.Flags().Changed("description") || len(meta.Description) == 0 {
+		meta.Description["en"] = description
+	}
+
+	if cmd.Flags().Changed("build-epoch") {
+		meta.BuildEpoch, epochSet = buildEpoch, true
+	}
+	if !epochSet {
+		epoch, err := defaultBuildEpoch()
+		if err != nil {
+			return meta, err
+		}
+		meta.BuildEpoch = epoch
+	}
+	if meta.BuildEpoch < 0 {
+		return meta, fmt.Errorf("build epoch must not be negative")
+	}
+
+	return meta, nil
+}
+
+// defaultBuildEpoch returns SOURCE_DATE_EPOCH when it is set and the current
+// time otherwise.
+func defaultBuildEpoch() (int64, error) {
+	if env := os.Getenv("SOURCE_DATE_EPOCH"); env != "" {
+		epoch, err := strconv.ParseInt(env, 10, 64)
+		if err != nil {
+			return 0, fmt.Errorf("invalid SOURCE_DATE_EPOCH %q: %v", env, err)
+		}
+		return epoch, nil
+	}
+	return time.Now().Unix(), nil
+}
+
+// Null handling modes for JSON null values.
+const (
+	nullOmit  = "omit"
+	nullEmpty = "empty"
+	nullError = "error"
+)
+
+// convertToMMDBType recursively converts interface{} into mmdbtype.DataType.
+// JSON null values are handled according to nulls: with nullOmit they are
+// dropped from maps and arrays and a nil DataType is returned, with nullEmpty
+// they become an empty string and with nullError they are rejected.
+func convertToMMDBType(value interface{}, nulls string) (mmdbtype.DataType, error) {
 	switch v := value.(type) {
 	case nil:
-		return mmdbtype.String(""), nil
+		switch nulls {
+		case nullOmit:
+			return nil, nil
+		case nullError:
+			return nil, fmt.Errorf("null value")
+		default:
+			return mmdbtype.String(""), nil
+		}
 	case string:
 		return mmdbtype.String(v), nil
 	case bool:
@@ -297,19 +909,25 @@ func convertToMMDBType(value interface{}) (mmdbtype.DataType, error) {
 	case map[string]interface{}:
 		m := mmdbtype.Map{}
 		for k, val := range v {
-			conv, err := convertToMMDBType(val)
+			conv, err := convertToMMDBType(val, nulls)
 			if err != nil {
-				return nil, err
+				return nil, fmt.Errorf("%s: %v", k, err)
+			}
+			if conv == nil {
+				continue
 			}
 			m[mmdbtype.String(k)] = conv
 		}
 		return m, nil
 	case []interface{}:
 		arr := mmdbtype.Slice{}
-		for _, val := range v {
-			conv, err := convertToMMDBType(val)
+		for i, val := range v {
+			conv, err := convertToMMDBType(val, nulls)
 			if err != nil {
-				return nil, err
+				return nil, fmt.Errorf("[%d]: %v", i, err)
+			}
+			if conv == nil {
+				continue
 			}
 			arr = append(arr, conv)
 		}
@@ -323,13 +941,30 @@ func convertToMMDBType(value interface{}) (mmdbtype.DataType, error) {
 func init() {
 	rootCmd.AddCommand(importCmd)
 
-	importCmd.Flags().StringVarP(&inPath, "in", "i", "", "Input JSON file path (from export command)")
+	importCmd.Flags().StringArrayVarP(&inPaths, "in", "i", nil, "Input file path, repeatable for layered imports (e.g. file=fixes.json,merge=recurse,namespace=ours)")
+	importCmd.Flags().StringVar(&inputFormat, "format", formatJSON, "Default input format: json, ndjson, list, csv")
+	importCmd.Flags().StringVar(&listRecord, "record", defaultListRecord, "JSON record for list inputs; {{name}} and {{file}} are replaced by the file name")
 	importCmd.Flags().StringVarP(&outPath, "out", "o", "", "Output .mmdb file path")
-	importCmd.Flags().IntVar(&ipVersion, "ip", 6, "IP version (4 or 6)")
+	importCmd.Flags().StringVar(&ipMode, "ip", ipModeV6, "IP version: 4, 6 or auto")
+	importCmd.Flags().BoolVar(&splitFamilies, "split", false, "Write IPv4 and IPv6 networks to separate -ipv4 and -ipv6 databases")
 	importCmd.Flags().IntVar(&recordSize, "size", 32, "Record size (24, 28, or 32)")
-	importCmd.Flags().StringVar(&mergeStrategyName, "merge", "none", "Merge strategy: none, toplevel, recurse")
+	importCmd.Flags().StringVar(&mergeStrategyName, "merge", "none", "Merge strategy: none, toplevel, recurse, policy")
+	importCmd.Flags().StringVar(&mergePolicyPath, "merge-policy", "", "JSON file with merge rules per field path (implies --merge policy)")
 	importCmd.Flags().BoolVar(&alias6to4, "alias-6to4", false, "Enable IPv6 to IPv4 aliasing")
 	importCmd.Flags().BoolVar(&disallowReserved, "disallow-reserved", false, "Disallow inserting reserved IP ranges")
-	importCmd.Flags().StringVarP(&title, "title", "t", "Custom-ip-database", "Title for the .mmdb file")
-	importCmd.Flags().StringVarP(&description, "description", "d", "Custom IP Intelligence Database", "Description for the .mmdb file")
+	importCmd.Flags().StringArrayVar(&excludePaths, "exclude", nil, "List of CIDRs and ranges to remove from the database, repeatable")
+	importCmd.Flags().BoolVar(&excludeBogons, "exclude-bogons", false, "Remove special-purpose (RFC 6890) and documentation ranges")
+	importCmd.Flags().StringVarP(&title, "title", "t", "Custom-ip-database", "Title (database_type) for the .mmdb file")
+	importCmd.Flags().StringVarP(&description, "description", "d", "Custom IP Intelligence Database", "English description for the .mmdb file")
+	importCmd.Flags().StringToStringVar(&descriptions, "descriptions", nil, "Descriptions per language (e.g. en=Threats,de=Bedrohungen)")
+	importCmd.Flags().StringSliceVar(&languages, "languages", []string{"en"}, "Languages listed in the .mmdb metadata")
+	importCmd.Flags().Int64Var(&buildEpoch, "build-epoch", 0, "Build time as a Unix timestamp (defaults to SOURCE_DATE_EPOCH or now)")
+	importCmd.Flags().StringVar(&metadataPath, "metadata", "", "JSON file with database_type, description, languages and build_epoch")
+	importCmd.Flags().StringVar(&overlapPolicy, "overlap", overlapSpecific, "Precedence for overlapping networks: specific, file, error")
+	importCmd.Flags().StringVar(&conflictsPath, "conflicts", "", "Write a JSON report of overlapping networks and their resolution")
+	importCmd.Flags().StringVar(&nullMode, "null", nullEmpty, "Handling of JSON null values: omit, empty, error")
+	importCmd.Flags().BoolVar(&strictImport, "strict", false, "Fail on the first invalid, reserved or failed entry")
+	importCmd.Flags().StringVar(&reportPath, "report", "", "Write a JSON report of counts and rejected keys")
+	importCmd.Flags().StringVar(&importSignKeyPath, "sign-key", "", "Ed25519 private key (PEM) to sign the output with, written to <out>.sig")
+	importCmd.Flags().BoolVar(&writeManifests, "manifest", false, "Write <out>.manifest.json with the build provenance and <out>.sha256")
 }
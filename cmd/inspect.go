@@ -7,7 +7,6 @@ import (
 	"net"
 	"os"
 	"path/filepath"
-	"reflect"
 	"strings"
 
 	"github.com/oschwald/maxminddb-golang"
@@ -19,11 +18,38 @@ var (
 	sampleIP      string
 	outputPath    string
 	schemaMap     = make(map[string]string)
+
+	inspectScan   bool
+	inspectSample float64
 )
 
 var inspectCmd = &cobra.Command{
 	Use:   "inspect",
 	Short: "Inspect MMDB structure and optionally export schema to JSON",
+	Long: `Inspects the structure of the records in an MMDB file.
+
+By default the record of one sample IP (--sample-ip) is described: every
+value with its path and the type it is stored with in the data section,
+as named in the MaxMind DB specification (utf8_string, double, float,
+bytes, uint16, uint32, int32, uint64, uint128, boolean, map, array).
+Maps and arrays show their number of entries, and values stored once and
+referenced by a pointer are marked "via pointer". Typed readers such as
+the Java and C# GeoIP2 APIs depend on these exact types. --out exports
+the path of every value with its type as JSON.
+
+With --scan, the records of all networks are merged into one schema
+instead, so fields that only some records have are found too. Every field
+path is listed with the MMDB types seen, the share of records that have
+it, the fewest and most entries of maps and arrays, the share of values
+stored behind a pointer and an example value. Array elements are
+collapsed into one path ending in "[]", e.g. "subdivisions[].iso_code".
+--sample decodes only an evenly spread share of the networks, which is
+much faster on large databases.
+
+Example:
+  mmdbio inspect --db GeoLite2-City.mmdb --sample-ip 8.8.8.8
+  mmdbio inspect --db GeoLite2-City.mmdb --scan --sample 0.01 \
+    --out schema.json`,
 	Run: func(cmd *cobra.Command, args []string) {
 		if inspectDBPath == "" {
 			fmt.Println("Error: --db flag is required")
@@ -38,6 +64,21 @@ var inspectCmd = &cobra.Command{
 		}
 		defer db.Close()
 
+		if inspectScan {
+			if inspectSample <= 0 || inspectSample > 1 {
+				log.Fatalf("--sample must be greater than 0 and at most 1")
+			}
+			scan, err := scanSchema(db, inspectSample)
+			if err != nil {
+				log.Fatalf("Scan failed: %v", err)
+			}
+			printSchemaScan(os.Stdout, filepath.Base(inspectDBPath), scan)
+			if outputPath != "" && scan.Records > 0 {
+				saveSchemaScanJSON(outputPath, scan)
+			}
+			return
+		}
+
 		// Parse IP (fallback to Google DNS)
 		ip := net.ParseIP(sampleIP)
 		if ip == nil {
@@ -45,23 +86,37 @@ var inspectCmd = &cobra.Command{
 		}
 
 		// Lookup
-		var record interface{}
-		if err := db.Lookup(ip, &record); err != nil {
+		offset, err := db.LookupOffset(ip)
+		if err != nil {
 			log.Fatalf("Lookup failed: %v", err)
 		}
-		if record == nil {
-			fmt.Println("No record found for this IP.")
+		if offset == maxminddb.NotFound {
+			fmt.Println("No record found for this IP. Use --scan to inspect all records.")
 			return
 		}
 
 		fmt.Println("📂 Structure for MMDB:", strings.Split(inspectDBPath, "/")[len(strings.Split(inspectDBPath, "/"))-1])
 		fmt.Println("────────────────────────────────────────────")
 
-		explore("", record)
+		var details []string
+		dec := &mmdbValueDecoder{visit: func(v wireValue) {
+			if v.Path == "" && v.Type == wireMap {
+				return
+			}
+			path := v.Path
+			if path == "" {
+				path = "(record)"
+			}
+			schemaMap[path] = v.Type
+			details = append(details, fmt.Sprintf("%-50s : %s", path, describeWireValue(v)))
+		}}
+		if err := db.Decode(offset, dec); err != nil {
+			log.Fatalf("Failed to decode record: %v", err)
+		}
 
-		// Print to console
-		for k, v := range schemaMap {
-			fmt.Printf("%-50s : %s\n", k, v)
+		// Print to console, in record order
+		for _, line := range details {
+			fmt.Println(line)
 		}
 
 		// Export if requested
@@ -71,27 +126,20 @@ var inspectCmd = &cobra.Command{
 	},
 }
 
-func explore(prefix string, data interface{}) {
-	switch v := data.(type) {
-	case map[string]interface{}:
-		for key, val := range v {
-			path := key
-			if prefix != "" {
-				path = prefix + "." + key
-			}
-			explore(path, val)
-		}
-	case []interface{}:
-		for i, val := range v {
-			explore(fmt.Sprintf("%s[%d]", prefix, i), val)
-		}
-	default:
-		typeName := "unknown"
-		if v != nil {
-			typeName = reflect.TypeOf(v).String()
-		}
-		schemaMap[prefix] = typeName
+// describeWireValue returns the MMDB type of v, with the size of maps and
+// arrays and whether it is stored behind a pointer.
+func describeWireValue(v wireValue) string {
+	desc := v.Type
+	switch v.Type {
+	case wireMap:
+		desc += fmt.Sprintf(" (%d entries)", v.Size)
+	case wireArray:
+		desc += fmt.Sprintf(" (%d elements)", v.Size)
+	}
+	if v.Pointer {
+		desc += " via pointer"
 	}
+	return desc
 }
 
 func saveSchemaJSON(path string, schema map[string]string) {
@@ -117,4 +165,6 @@ func init() {
 	inspectCmd.Flags().StringVar(&inspectDBPath, "db", "", "Path to the .mmdb file")
 	inspectCmd.Flags().StringVar(&sampleIP, "sample-ip", "", "Sample IP to inspect structure")
 	inspectCmd.Flags().StringVar(&outputPath, "out", "", "Optional path to export schema as JSON")
+	inspectCmd.Flags().BoolVar(&inspectScan, "scan", false, "Merge the structure of the records of all networks")
+	inspectCmd.Flags().Float64Var(&inspectSample, "sample", 1, "With --scan, the share of networks to decode (0-1]")
 }
@@ -0,0 +1,128 @@
+package cmd
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+	"text/tabwriter"
+
+	"github.com/maxmind/mmdbwriter/inserter"
+)
+
+// importLayer is one input source of an import. Layers are applied in the
+// order they are given, so later layers take precedence over earlier ones.
+type importLayer struct {
+	Path      string
+	Format    string
+	Merge     string
+	Namespace string
+}
+
+// layerStats records how many networks a layer touched.
+type layerStats struct {
+	Source    string `json:"source"`
+	Format    string `json:"format"`
+	Merge     string `json:"merge"`
+	Namespace string `json:"namespace,omitempty"`
+	Entries   int    `json:"entries"`
+	Inserted  int    `json:"inserted"`
+	Merged    int    `json:"merged"`
+	Rejected  int    `json:"rejected"`
+	Networks  int    `json:"networks"`
+}
+
+// parseLayerSpec parses an --in value. A value is either a plain file path or
+// a spec such as "file=fixes.json,format=ndjson,merge=recurse,namespace=ours".
+// A path with glob characters expands to one layer per matching file.
+func parseLayerSpec(spec, defaultFormat, defaultMerge string) ([]importLayer, error) {
+	layer, err := parseLayerOptions(spec, defaultFormat, defaultMerge)
+	if err != nil {
+		return nil, err
+	}
+	if !strings.ContainsAny(layer.Path, "*?[") {
+		return []importLayer{layer}, nil
+	}
+
+	matches, err := filepath.Glob(layer.Path)
+	if err != nil {
+		return nil, fmt.Errorf("invalid pattern %q: %v", layer.Path, err)
+	}
+	if len(matches) == 0 {
+		return nil, fmt.Errorf("no files match %q", layer.Path)
+	}
+	layers := make([]importLayer, 0, len(matches))
+	for _, match := range matches {
+		l := layer
+		l.Path = match
+		layers = append(layers, l)
+	}
+	return layers, nil
+}
+
+// parseLayerOptions parses a single --in value without expanding globs.
+func parseLayerOptions(spec, defaultFormat, defaultMerge string) (importLayer, error) {
+	layer := importLayer{Path: spec, Format: defaultFormat, Merge: defaultMerge}
+	if !strings.HasPrefix(spec, "file=") {
+		return layer, nil
+	}
+
+	layer.Path = ""
+	for _, part := range strings.Split(spec, ",") {
+		key, value, ok := strings.Cut(part, "=")
+		if !ok {
+			return layer, fmt.Errorf("invalid --in option %q in %q", part, spec)
+		}
+		switch key {
+		case "file":
+			layer.Path = value
+		case "format":
+			layer.Format = value
+		case "merge":
+			layer.Merge = value
+		case "namespace":
+			layer.Namespace = value
+		default:
+			return layer, fmt.Errorf("unknown --in option %q, must be one of: file, format, merge, namespace", key)
+		}
+	}
+	if layer.Path == "" {
+		return layer, fmt.Errorf("missing file in --in %q", spec)
+	}
+	return layer, nil
+}
+
+// mergeStrategyFor returns the mmdbwriter inserter for a --merge value.
+// "policy" uses the merge policy loaded from --merge-policy.
+func mergeStrategyFor(name string) (inserter.FuncGenerator, error) {
+	switch name {
+	case "none":
+		return inserter.ReplaceWith, nil
+	case "toplevel":
+		return inserter.TopLevelMergeWith, nil
+	case "recurse":
+		return inserter.DeepMergeWith, nil
+	case "policy":
+		if mergePolicyStrategy == nil {
+			return nil, fmt.Errorf("merge \"policy\" requires --merge-policy")
+		}
+		return mergePolicyStrategy, nil
+	default:
+		return nil, fmt.Errorf("merge must be one of: none, toplevel, recurse, policy")
+	}
+}
+
+// printLayerSummary prints how many networks each layer touched.
+func printLayerSummary(layers []layerStats) {
+	w := tabwriter.NewWriter(os.Stderr, 0, 0, 2, ' ', 0)
+	fmt.Fprintln(w, "LAYER\tSOURCE\tFORMAT\tMERGE\tNAMESPACE\tENTRIES\tINSERTED\tMERGED\tREJECTED\tNETWORKS")
+	for i, l := range layers {
+		ns := l.Namespace
+		if ns == "" {
+			ns = "-"
+		}
+		fmt.Fprintf(w, "%d\t%s\t%s\t%s\t%s\t%d\t%d\t%d\t%d\t%d\n",
+			i+1, l.Source, l.Format, l.Merge, ns, l.Entries, l.Inserted, l.Merged, l.Rejected, l.Networks)
+	}
+	w.Flush()
+}
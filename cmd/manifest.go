@@ -0,0 +1,142 @@
+package cmd
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+
+	"github.com/oschwald/maxminddb-golang"
+	"github.com/spf13/cobra"
+	"github.com/spf13/pflag"
+)
+
+// buildManifest records how an imported database was made, so it can be
+// traced back to its exact sources. It is written to <out>.manifest.json.
+type buildManifest struct {
+	Tool         string                 `json:"tool"`
+	Version      string                 `json:"version"`
+	Output       manifestOutput         `json:"output"`
+	Metadata     importMetadata         `json:"metadata"`
+	Inputs       []manifestInput        `json:"inputs"`
+	Files        []manifestFile         `json:"files,omitempty"`
+	Flags        map[string]interface{} `json:"flags"`
+	Counts       importCounts           `json:"counts"`
+	Excluded     int                    `json:"excluded"`
+	Layers       []layerStats           `json:"layers"`
+	OverlapCount int                    `json:"overlap_count"`
+	SigningKey   string                 `json:"signing_key,omitempty"`
+}
+
+// manifestOutput describes the written database.
+type manifestOutput struct {
+	Path       string `json:"path"`
+	SHA256     string `json:"sha256"`
+	Size       int64  `json:"size"`
+	IPVersion  uint   `json:"ip_version"`
+	RecordSize uint   `json:"record_size"`
+	NodeCount  uint   `json:"node_count"`
+	Entries    int    `json:"entries"`
+}
+
+// manifestInput is an input layer and the hash of its file.
+type manifestInput struct {
+	manifestFile
+	Format    string `json:"format"`
+	Merge     string `json:"merge"`
+	Namespace string `json:"namespace,omitempty"`
+}
+
+// manifestFile is a file that influenced the build, such as an exclusion
+// list or the merge policy.
+type manifestFile struct {
+	Role   string `json:"role,omitempty"`
+	Path   string `json:"path"`
+	SHA256 string `json:"sha256"`
+	Size   int64  `json:"size"`
+}
+
+// hashFile returns the hex SHA-256 and size of the file at path.
+func hashFile(path string) (string, int64, error) {
+	file, err := os.Open(path)
+	if err != nil {
+		return "", 0, err
+	}
+	defer file.Close()
+
+	h := sha256.New()
+	n, err := io.Copy(h, file)
+	if err != nil {
+		return "", 0, err
+	}
+	return hex.EncodeToString(h.Sum(nil)), n, nil
+}
+
+// describeFile hashes path for the manifest.
+func describeFile(role, path string) (manifestFile, error) {
+	sum, size, err := hashFile(path)
+	if err != nil {
+		return manifestFile{}, fmt.Errorf("failed to hash %s: %v", path, err)
+	}
+	return manifestFile{Role: role, Path: path, SHA256: sum, Size: size}, nil
+}
+
+// flagValues returns the value of every flag of cmd, set or not.
+func flagValues(cmd *cobra.Command) map[string]interface{} {
+	values := map[string]interface{}{}
+	cmd.Flags().VisitAll(func(f *pflag.Flag) {
+		if f.Name == "help" {
+			return
+		}
+		if s, ok := f.Value.(pflag.SliceValue); ok {
+			values[f.Name] = s.GetSlice()
+			return
+		}
+		values[f.Name] = f.Value.String()
+	})
+	return values
+}
+
+// writeManifest writes <out>.manifest.json and <out>.sha256 for output.
+// The remaining fields of manifest are filled in by the caller.
+func writeManifest(manifest buildManifest, output importOutput) error {
+	sum, size, err := hashFile(output.Path)
+	if err != nil {
+		return fmt.Errorf("failed to hash %s: %v", output.Path, err)
+	}
+
+	db, err := maxminddb.Open(output.Path)
+	if err != nil {
+		return fmt.Errorf("failed to open %s: %v", output.Path, err)
+	}
+	meta := db.Metadata
+	db.Close()
+
+	manifest.Output = manifestOutput{
+		Path:       output.Path,
+		SHA256:     sum,
+		Size:       size,
+		IPVersion:  meta.IPVersion,
+		RecordSize: meta.RecordSize,
+		NodeCount:  meta.NodeCount,
+		Entries:    output.Inserted,
+	}
+
+	out, err := json.MarshalIndent(manifest, "", "  ")
+	if err != nil {
+		return err
+	}
+	if err := os.WriteFile(output.Path+".manifest.json", append(out, '\n'), 0644); err != nil {
+		return fmt.Errorf("failed to write manifest: %v", err)
+	}
+
+	// Same format as sha256sum, so "sha256sum -c" can verify it
+	line := fmt.Sprintf("%s  %s\n", sum, filepath.Base(output.Path))
+	if err := os.WriteFile(output.Path+".sha256", []byte(line), 0644); err != nil {
+		return fmt.Errorf("failed to write checksum: %v", err)
+	}
+	return nil
+}
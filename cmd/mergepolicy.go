@@ -0,0 +1,315 @@
+package cmd
+
+import (
+	"encoding/json"
+	"fmt"
+	"math"
+	"math/big"
+	"os"
+
+	"github.com/maxmind/mmdbwriter/inserter"
+	"github.com/maxmind/mmdbwriter/mmdbtype"
+)
+
+// Merge rules that can be assigned to a field path in a merge policy.
+const (
+	ruleLast    = "last"
+	ruleFirst   = "first"
+	ruleRecurse = "recurse"
+	ruleUnion   = "union"
+	ruleMax     = "max"
+	ruleMin     = "min"
+	ruleSum     = "sum"
+)
+
+// mergePolicy is the --merge-policy file. Fields maps dot-separated field
+// paths to a merge rule. Default is the rule for values that have no rule of
+// their own and are not both maps; maps are merged recursively.
+type mergePolicy struct {
+	Default string            `json:"default"`
+	Fields  map[string]string `json:"fields"`
+}
+
+// loadMergePolicy reads a merge policy file and compiles it into an inserter.
+func loadMergePolicy(path string) (inserter.FuncGenerator, error) {
+	raw, err := os.ReadFile(path)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read merge policy: %v", err)
+	}
+	var policy mergePolicy
+	if err := json.Unmarshal(raw, &policy); err != nil {
+		return nil, fmt.Errorf("failed to parse merge policy: %v", err)
+	}
+	return policy.compile()
+}
+
+// compile validates the policy and returns an mmdbwriter inserter that
+// applies it when a network already holds data.
+func (p mergePolicy) compile() (inserter.FuncGenerator, error) {
+	if p.Default == "" {
+		p.Default = ruleLast
+	}
+	if p.Default != ruleLast && p.Default != ruleFirst {
+		return nil, fmt.Errorf("merge policy default must be one of: last, first")
+	}
+	for path, rule := range p.Fields {
+		switch rule {
+		case ruleLast, ruleFirst, ruleRecurse, ruleUnion, ruleMax, ruleMin, ruleSum:
+		default:
+			return nil, fmt.Errorf("unknown merge rule %q for %s, must be one of: last, first, recurse, union, max, min, sum", rule, path)
+		}
+	}
+
+	return func(newValue mmdbtype.DataType) inserter.Func {
+		return func(existing mmdbtype.DataType) (mmdbtype.DataType, error) {
+			return p.merge("", existing, newValue)
+		}
+	}, nil
+}
+
+// merge combines the existing and new value found at path.
+func (p mergePolicy) merge(path string, existing, newValue mmdbtype.DataType) (mmdbtype.DataType, error) {
+	if existing == nil {
+		return newValue, nil
+	}
+	if newValue == nil {
+		return existing, nil
+	}
+
+	rule, ok := p.Fields[path]
+	if !ok {
+		rule = ruleRecurse
+	}
+
+	switch rule {
+	case ruleLast:
+		return newValue, nil
+	case ruleFirst:
+		return existing, nil
+	case ruleUnion:
+		return unionValues(existing, newValue), nil
+	case ruleMax, ruleMin, ruleSum:
+		v, err := combineNumbers(rule, existing, newValue)
+		if err != nil {
+			return nil, fmt.Errorf("%s: %v", path, err)
+		}
+		return v, nil
+	}
+
+	existingMap, ok1 := existing.(mmdbtype.Map)
+	newMap, ok2 := newValue.(mmdbtype.Map)
+	if !ok1 || !ok2 {
+		if p.Default == ruleFirst {
+			return existing, nil
+		}
+		return newValue, nil
+	}
+
+	merged := make(mmdbtype.Map, len(existingMap)+len(newMap))
+	for k, v := range existingMap {
+		merged[k] = v
+	}
+	for k, v := range newMap {
+		childPath := string(k)
+		if path != "" {
+			childPath = path + "." + childPath
+		}
+		mv, err := p.merge(childPath, merged[k], v)
+		if err != nil {
+			return nil, err
+		}
+		merged[k] = mv
+	}
+	return merged, nil
+}
+
+// unionValues returns the existing values followed by the new values that are
+// not already present. Non-array values are treated as single-element arrays.
+func unionValues(existing, newValue mmdbtype.DataType) mmdbtype.DataType {
+	union := mmdbtype.Slice{}
+	add := func(v mmdbtype.DataType) {
+		for _, u := range union {
+			if u.Equal(v) {
+				return
+			}
+		}
+		union = append(union, v)
+	}
+	for _, v := range asSlice(existing) {
+		add(v)
+	}
+	for _, v := range asSlice(newValue) {
+		add(v)
+	}
+	return union
+}
+
+// asSlice returns v as a slice, wrapping non-array values.
+func asSlice(v mmdbtype.DataType) mmdbtype.Slice {
+	if s, ok := v.(mmdbtype.Slice); ok {
+		return s
+	}
+	return mmdbtype.Slice{v}
+}
+
+// combineNumbers applies max, min or sum to two numeric values. max and min
+// keep the winning value with its type; integers are compared exactly and
+// only mixed integer and float values through big.Float. sum keeps the type
+// when both values share it, uses the wider type for two unsigned
+// integers and falls back to a double otherwise. A sum that does not fit
+// its type is an error rather than wrapping around.
+func combineNumbers(rule string, existing, newValue mmdbtype.DataType) (mmdbtype.DataType, error) {
+	a, ok1 := numberValue(existing)
+	b, ok2 := numberValue(newValue)
+	if !ok1 || !ok2 {
+		return nil, fmt.Errorf("%s needs numeric values, got %T and %T", rule, existing, newValue)
+	}
+	if math.IsNaN(a) || math.IsNaN(b) {
+		return nil, fmt.Errorf("%s cannot combine NaN", rule)
+	}
+	x, xInt := integerValue(existing)
+	y, yInt := integerValue(newValue)
+
+	switch rule {
+	case ruleMax, ruleMin:
+		var cmp int
+		if xInt && yInt {
+			cmp = y.Cmp(x)
+		} else {
+			cmp = bigFloat(y, b).Cmp(bigFloat(x, a))
+		}
+		if (rule == ruleMax && cmp > 0) || (rule == ruleMin && cmp < 0) {
+			return newValue, nil
+		}
+		return existing, nil
+	}
+
+	if xInt && yInt {
+		typ := sumType(existing, newValue)
+		if typ != "" {
+			sum := new(big.Int).Add(x, y)
+			v, err := integerOfType(typ, sum)
+			if err != nil {
+				return nil, fmt.Errorf("sum of %s and %s %v", x, y, err)
+			}
+			return v, nil
+		}
+	}
+
+	var sum mmdbtype.DataType = mmdbtype.Float64(a + b)
+	if e, ok := existing.(mmdbtype.Float32); ok {
+		if n, ok := newValue.(mmdbtype.Float32); ok {
+			sum = e + n
+		}
+	}
+	if f, _ := numberValue(sum); math.IsInf(f, 0) {
+		return nil, fmt.Errorf("sum of %v and %v overflows %s", a, b, numberType(sum))
+	}
+	return sum, nil
+}
+
+// numberValue returns v as a float64 if it is a numeric MMDB type.
+func numberValue(v mmdbtype.DataType) (float64, bool) {
+	switch n := v.(type) {
+	case mmdbtype.Float64:
+		return float64(n), true
+	case mmdbtype.Float32:
+		return float64(n), true
+	}
+	if i, ok := integerValue(v); ok {
+		f, _ := new(big.Float).SetInt(i).Float64()
+		return f, true
+	}
+	return 0, false
+}
+
+// integerValue returns v as a big.Int if it is an integer MMDB type.
+func integerValue(v mmdbtype.DataType) (*big.Int, bool) {
+	switch n := v.(type) {
+	case mmdbtype.Int32:
+		return big.NewInt(int64(n)), true
+	case mmdbtype.Uint16:
+		return new(big.Int).SetUint64(uint64(n)), true
+	case mmdbtype.Uint32:
+		return new(big.Int).SetUint64(uint64(n)), true
+	case mmdbtype.Uint64:
+		return new(big.Int).SetUint64(uint64(n)), true
+	case *mmdbtype.Uint128:
+		return new(big.Int).Set((*big.Int)(n)), true
+	default:
+		return nil, false
+	}
+}
+
+// bigFloat returns the exact value of a number given as an integer i, or
+// for floats as f.
+func bigFloat(i *big.Int, f float64) *big.Float {
+	if i != nil {
+		return new(big.Float).SetInt(i)
+	}
+	return big.NewFloat(f)
+}
+
+// unsignedWidth orders the unsigned integer types by size.
+var unsignedWidth = map[string]int{typeUint16: 1, typeUint32: 2, typeUint64: 3, typeUint128: 4}
+
+// sumType returns the type of the sum of two integers: their type if they
+// share it, the wider one if both are unsigned, and "" otherwise.
+func sumType(a, b mmdbtype.DataType) string {
+	ta, tb := numberType(a), numberType(b)
+	if ta == tb {
+		return ta
+	}
+	wa, okA := unsignedWidth[ta]
+	wb, okB := unsignedWidth[tb]
+	if !okA || !okB {
+		return ""
+	}
+	if wa > wb {
+		return ta
+	}
+	return tb
+}
+
+// numberType returns the MMDB type name of a number as used in patches,
+// with "double" for doubles.
+func numberType(v mmdbtype.DataType) string {
+	if _, types := encodePatchValue(v); types[""] != "" {
+		return types[""]
+	}
+	return "double"
+}
+
+// integerOfType returns n as an integer of the given MMDB type, or an error
+// if it does not fit.
+func integerOfType(typ string, n *big.Int) (mmdbtype.DataType, error) {
+	var limit *big.Int
+	switch typ {
+	case typeInt32:
+		if n.IsInt64() && n.Int64() >= math.MinInt32 && n.Int64() <= math.MaxInt32 {
+			return mmdbtype.Int32(n.Int64()), nil
+		}
+		return nil, fmt.Errorf("overflows int32")
+	case typeUint16:
+		limit = new(big.Int).SetUint64(math.MaxUint16)
+	case typeUint32:
+		limit = new(big.Int).SetUint64(math.MaxUint32)
+	case typeUint64:
+		limit = new(big.Int).SetUint64(math.MaxUint64)
+	case typeUint128:
+		limit = new(big.Int).Sub(new(big.Int).Lsh(big.NewInt(1), 128), big.NewInt(1))
+	}
+	if n.Sign() < 0 || n.Cmp(limit) > 0 {
+		return nil, fmt.Errorf("overflows %s", typ)
+	}
+	switch typ {
+	case typeUint16:
+		return mmdbtype.Uint16(n.Uint64()), nil
+	case typeUint32:
+		return mmdbtype.Uint32(n.Uint64()), nil
+	case typeUint64:
+		return mmdbtype.Uint64(n.Uint64()), nil
+	}
+	u := mmdbtype.Uint128(*new(big.Int).Set(n))
+	return &u, nil
+}
@@ -0,0 +1,63 @@
+package cmd
+
+import (
+	"math"
+	"math/big"
+	"strings"
+	"testing"
+
+	"github.com/maxmind/mmdbwriter/mmdbtype"
+)
+
+func uint128(s string) *mmdbtype.Uint128 {
+	n, _ := new(big.Int).SetString(s, 10)
+	return (*mmdbtype.Uint128)(n)
+}
+
+func TestCombineNumbers(t *testing.T) {
+	maxUint128 := "340282366920938463463374607431768211455"
+	tests := []struct {
+		name     string
+		rule     string
+		existing mmdbtype.DataType
+		newValue mmdbtype.DataType
+		want     mmdbtype.DataType
+		err      string
+	}{
+		{name: "uint16", rule: ruleSum, existing: mmdbtype.Uint16(1), newValue: mmdbtype.Uint16(2), want: mmdbtype.Uint16(3)},
+		{name: "uint16 max", rule: ruleSum, existing: mmdbtype.Uint16(65534), newValue: mmdbtype.Uint16(1), want: mmdbtype.Uint16(65535)},
+		{name: "uint16 overflow", rule: ruleSum, existing: mmdbtype.Uint16(65535), newValue: mmdbtype.Uint16(1), err: "overflows uint16"},
+		{name: "uint16 and uint32 widen", rule: ruleSum, existing: mmdbtype.Uint16(65535), newValue: mmdbtype.Uint32(1), want: mmdbtype.Uint32(65536)},
+		{name: "uint32 overflow", rule: ruleSum, existing: mmdbtype.Uint32(math.MaxUint32), newValue: mmdbtype.Uint16(1), err: "overflows uint32"},
+		{name: "uint64 overflow", rule: ruleSum, existing: mmdbtype.Uint64(math.MaxUint64), newValue: mmdbtype.Uint64(1), err: "overflows uint64"},
+		{name: "uint64 exact", rule: ruleSum, existing: mmdbtype.Uint64(1 << 60), newValue: mmdbtype.Uint64(1), want: mmdbtype.Uint64(1<<60 + 1)},
+		{name: "uint128 max", rule: ruleSum, existing: uint128("340282366920938463463374607431768211454"), newValue: uint128("1"), want: uint128(maxUint128)},
+		{name: "uint128 overflow", rule: ruleSum, existing: uint128(maxUint128), newValue: uint128("1"), err: "overflows uint128"},
+		{name: "int32 overflow", rule: ruleSum, existing: mmdbtype.Int32(math.MaxInt32), newValue: mmdbtype.Int32(1), err: "overflows int32"},
+		{name: "int32 underflow", rule: ruleSum, existing: mmdbtype.Int32(math.MinInt32), newValue: mmdbtype.Int32(-1), err: "overflows int32"},
+		{name: "int32 and uint16 as double", rule: ruleSum, existing: mmdbtype.Int32(-1), newValue: mmdbtype.Uint16(3), want: mmdbtype.Float64(2)},
+		{name: "double overflow", rule: ruleSum, existing: mmdbtype.Float64(1e308), newValue: mmdbtype.Float64(1e308), err: "overflows double"},
+		{name: "float overflow", rule: ruleSum, existing: mmdbtype.Float32(3e38), newValue: mmdbtype.Float32(3e38), err: "overflows float"},
+		{name: "NaN", rule: ruleSum, existing: mmdbtype.Float64(math.NaN()), newValue: mmdbtype.Float64(1), err: "cannot combine NaN"},
+		{name: "string", rule: ruleSum, existing: mmdbtype.String("1"), newValue: mmdbtype.Uint16(1), err: "needs numeric values"},
+		{name: "max uint64 exact", rule: ruleMax, existing: mmdbtype.Uint64(math.MaxUint64), newValue: mmdbtype.Uint64(math.MaxUint64 - 1), want: mmdbtype.Uint64(math.MaxUint64)},
+		{name: "min of mixed types", rule: ruleMin, existing: mmdbtype.Uint32(5), newValue: mmdbtype.Float64(4.5), want: mmdbtype.Float64(4.5)},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := combineNumbers(tt.rule, tt.existing, tt.newValue)
+			if tt.err != "" {
+				if err == nil || !strings.Contains(err.Error(), tt.err) {
+					t.Fatalf("combineNumbers() = %v, %v, want error %q", got, err, tt.err)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("combineNumbers() error = %v", err)
+			}
+			if !got.Equal(tt.want) {
+				t.Errorf("combineNumbers() = %#v, want %#v", got, tt.want)
+			}
+		})
+	}
+}
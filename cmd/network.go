@@ -0,0 +1,167 @@
+package cmd
+
+import (
+	"fmt"
+	"math/big"
+	"net"
+	"net/netip"
+	"strconv"
+	"strings"
+
+	"go4.org/netipx"
+)
+
+// maxIPv6 is the largest integer that is a valid IPv6 address.
+var maxIPv6 = new(big.Int).Sub(new(big.Int).Lsh(big.NewInt(1), 128), big.NewInt(1))
+
+// parseNetworkKey parses an import key into the range of addresses it covers.
+// A key is one of:
+//   - a CIDR block ("1.2.3.0/24"), also with a netmask ("1.2.3.0/255.255.255.0"
+//     or "1.2.3.0 255.255.255.0")
+//   - a single IP ("8.8.8.8")
+//   - an IP range ("1.2.3.0-1.2.3.255"), with optional spaces around the dash
+//
+// Addresses may also be written as decimal or hex integers ("16909056",
+// "0x01020300"), and IPv4-mapped IPv6 addresses ("::ffff:1.2.3.4") are
+// treated as IPv4. A CIDR block with host bits set is masked to its network
+// and a warning describing the change is returned.
+func parseNetworkKey(key string) (netipx.IPRange, string, error) {
+	key = strings.TrimSpace(key)
+
+	if start, end, ok := strings.Cut(key, "-"); ok {
+		from, _, err := parseKeyAddr(strings.TrimSpace(start))
+		if err != nil {
+			return netipx.IPRange{}, "", fmt.Errorf("invalid range %s: %v", key, err)
+		}
+		to, _, err := parseKeyAddr(strings.TrimSpace(end))
+		if err != nil {
+			return netipx.IPRange{}, "", fmt.Errorf("invalid range %s: %v", key, err)
+		}
+		if from.Is4() != to.Is4() {
+			return netipx.IPRange{}, "", fmt.Errorf("invalid range %s: mixes IPv4 and IPv6", key)
+		}
+		r := netipx.IPRangeFrom(from, to)
+		if !r.IsValid() {
+			return netipx.IPRange{}, "", fmt.Errorf("invalid range %s: start is after end", key)
+		}
+		return r, "", nil
+	}
+
+	base, mask, hasMask := strings.Cut(key, "/")
+	if fields := strings.Fields(key); !hasMask && len(fields) == 2 {
+		base, mask, hasMask = fields[0], fields[1], true
+	}
+	base, mask = strings.TrimSpace(base), strings.TrimSpace(mask)
+
+	addr, mapped, err := parseKeyAddr(base)
+	if err != nil {
+		return netipx.IPRange{}, "", fmt.Errorf("invalid network %s: %v", key, err)
+	}
+	if !hasMask {
+		return netipx.IPRangeFrom(addr, addr), "", nil
+	}
+
+	bits, err := parsePrefixLength(mask, addr, mapped)
+	if err != nil {
+		return netipx.IPRange{}, "", fmt.Errorf("invalid network %s: %v", key, err)
+	}
+	prefix := netip.PrefixFrom(addr, bits)
+	if !prefix.IsValid() {
+		return netipx.IPRange{}, "", fmt.Errorf("invalid network %s: prefix length out of range", key)
+	}
+
+	var warning string
+	if masked := prefix.Masked(); masked.Addr() != addr {
+		warning = fmt.Sprintf("host bits set in %s, using %s", key, masked)
+	}
+	return netipx.RangeOfPrefix(prefix.Masked()), warning, nil
+}
+
+// parseKeyAddr parses an address written as an IP or as a decimal or hex
+// integer. IPv4-mapped IPv6 addresses are unmapped and reported as mapped.
+func parseKeyAddr(s string) (netip.Addr, bool, error) {
+	if s == "" {
+		return netip.Addr{}, false, fmt.Errorf("missing address")
+	}
+
+	if n, ok := parseAddrInteger(s); ok {
+		if n.Cmp(maxIPv6) > 0 {
+			return netip.Addr{}, false, fmt.Errorf("%s is out of range", s)
+		}
+		if n.IsUint64() && n.Uint64() <= 0xffffffff {
+			v := uint32(n.Uint64())
+			return netip.AddrFrom4([4]byte{byte(v >> 24), byte(v >> 16), byte(v >> 8), byte(v)}), false, nil
+		}
+		var b [16]byte
+		n.FillBytes(b[:])
+		return netip.AddrFrom16(b), false, nil
+	}
+
+	addr, err := netip.ParseAddr(s)
+	if err != nil {
+		return netip.Addr{}, false, fmt.Errorf("invalid IP %s", s)
+	}
+	if addr.Zone() != "" {
+		return netip.Addr{}, false, fmt.Errorf("zoned IP %s is not allowed", s)
+	}
+	if addr.Is4In6() {
+		return addr.Unmap(), true, nil
+	}
+	return addr, false, nil
+}
+
+// parseAddrInteger parses s as a decimal or 0x-prefixed hex integer.
+func parseAddrInteger(s string) (*big.Int, bool) {
+	n := new(big.Int)
+	if hex, ok := strings.CutPrefix(strings.ToLower(s), "0x"); ok {
+		return n.SetString(hex, 16)
+	}
+	if strings.Trim(s, "0123456789") != "" {
+		return nil, false
+	}
+	return n.SetString(s, 10)
+}
+
+// parsePrefixLength parses a prefix length or netmask for addr. Lengths
+// given for an IPv4-mapped address count the 96 bits of the mapping prefix.
+func parsePrefixLength(mask string, addr netip.Addr, mapped bool) (int, error) {
+	if strings.ContainsAny(mask, ".:") {
+		m, err := netip.ParseAddr(mask)
+		if err != nil {
+			return 0, fmt.Errorf("invalid netmask %s", mask)
+		}
+		if m.Is4In6() {
+			m = m.Unmap()
+		}
+		if m.BitLen() != addr.BitLen() {
+			return 0, fmt.Errorf("netmask %s does not match the address family", mask)
+		}
+		ones, bits := net.IPMask(m.AsSlice()).Size()
+		if bits == 0 {
+			return 0, fmt.Errorf("netmask %s is not contiguous", mask)
+		}
+		return ones, nil
+	}
+
+	bits, err := strconv.Atoi(mask)
+	if err != nil {
+		return 0, fmt.Errorf("invalid prefix length %s", mask)
+	}
+	if mapped {
+		if bits < 96 {
+			return 0, fmt.Errorf("prefix length %d is shorter than the IPv4-mapped prefix", bits)
+		}
+		bits -= 96
+	}
+	return bits, nil
+}
+
+// rangeIPNets returns the CIDR blocks that exactly cover r.
+func rangeIPNets(r netipx.IPRange) []*net.IPNet {
+	prefixes := r.Prefixes()
+	nets := make([]*net.IPNet, 0, len(prefixes))
+	for _, p := range prefixes {
+		nets = append(nets, netipx.PrefixIPNet(p))
+	}
+	return nets
+}
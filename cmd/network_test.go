@@ -0,0 +1,78 @@
+package cmd
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestParseNetworkKey(t *testing.T) {
+	tests := []struct {
+		key     string
+		want    string
+		warning bool
+		err     string
+	}{
+		{key: "1.2.3.0/24", want: "1.2.3.0-1.2.3.255"},
+		{key: "8.8.8.8", want: "8.8.8.8-8.8.8.8"},
+		{key: "2001:db8::/126", want: "2001:db8::-2001:db8::3"},
+		{key: " 1.2.3.0 - 1.2.3.9 ", want: "1.2.3.0-1.2.3.9"},
+
+		// Netmasks
+		{key: "1.2.3.0/255.255.255.0", want: "1.2.3.0-1.2.3.255"},
+		{key: "1.2.2.0 255.255.254.0", want: "1.2.2.0-1.2.3.255"},
+		{key: "1.2.3.0/255.0.255.0", err: "not contiguous"},
+		{key: "1.2.3.0/ffff::", err: "does not match the address family"},
+
+		// Integers
+		{key: "16909056", want: "1.2.3.0-1.2.3.0"},
+		{key: "16909056/24", want: "1.2.3.0-1.2.3.255"},
+		{key: "16909056-16909311", want: "1.2.3.0-1.2.3.255"},
+		{key: "4294967296", want: "::1:0:0-::1:0:0"},
+		{key: "340282366920938463463374607431768211456", err: "out of range"},
+
+		// Hex
+		{key: "0x01020300/24", want: "1.2.3.0-1.2.3.255"},
+		{key: "0X0A000001", want: "10.0.0.1-10.0.0.1"},
+		{key: "0xfffffffffffffffffffffffffffffffff", err: "out of range"},
+
+		// IPv4-mapped
+		{key: "::ffff:1.2.3.4", want: "1.2.3.4-1.2.3.4"},
+		{key: "::ffff:1.2.3.0/120", want: "1.2.3.0-1.2.3.255"},
+		{key: "::ffff:1.2.3.0/64", err: "shorter than the IPv4-mapped prefix"},
+		{key: "::ffff:1.2.3.0-1.2.3.9", want: "1.2.3.0-1.2.3.9"},
+
+		// Host bits set
+		{key: "1.2.3.4/24", want: "1.2.3.0-1.2.3.255", warning: true},
+		{key: "2001:db8::1/64", want: "2001:db8::-2001:db8::ffff:ffff:ffff:ffff", warning: true},
+
+		// Invalid keys
+		{key: "", err: "missing address"},
+		{key: "not-an-ip", err: "invalid range"},
+		{key: "1.2.3", err: "invalid IP"},
+		{key: "1.2.3.0/33", err: "prefix length out of range"},
+		{key: "1.2.3.0/x", err: "invalid prefix length"},
+		{key: "fe80::1%eth0", err: "zoned IP"},
+		{key: "1.2.3.9-1.2.3.0", err: "start is after end"},
+		{key: "1.2.3.0-2001:db8::", err: "mixes IPv4 and IPv6"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.key, func(t *testing.T) {
+			r, warning, err := parseNetworkKey(tt.key)
+			if tt.err != "" {
+				if err == nil || !strings.Contains(err.Error(), tt.err) {
+					t.Fatalf("parseNetworkKey(%q) error = %v, want %q", tt.key, err, tt.err)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("parseNetworkKey(%q) error = %v", tt.key, err)
+			}
+			if got := r.String(); got != tt.want {
+				t.Errorf("parseNetworkKey(%q) = %s, want %s", tt.key, got, tt.want)
+			}
+			if (warning != "") != tt.warning {
+				t.Errorf("parseNetworkKey(%q) warning = %q, want warning %v", tt.key, warning, tt.warning)
+			}
+		})
+	}
+}
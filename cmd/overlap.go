@@ -0,0 +1,204 @@
+package cmd
+
+import (
+	"encoding/json"
+	"fmt"
+	"math/big"
+	"net/netip"
+	"os"
+	"path/filepath"
+	"sort"
+
+	"go4.org/netipx"
+)
+
+// Overlap policies for networks that appear more than once in the import input.
+const (
+	overlapSpecific = "specific"
+	overlapFile     = "file"
+	overlapError    = "error"
+)
+
+// importEntry is a single key and record from the import input.
+type importEntry struct {
+	Source string
+	Key    string
+	Index  int
+	Record interface{}
+	Range  netipx.IPRange
+}
+
+// overlapConflict describes two input keys whose networks overlap and how the
+// overlap was resolved.
+type overlapConflict struct {
+	Source         string `json:"source"`
+	First          string `json:"first"`
+	FirstPosition  int    `json:"first_position"`
+	Second         string `json:"second"`
+	SecondPosition int    `json:"second_position"`
+	Overlap        string `json:"overlap"`
+	Winner         string `json:"winner,omitempty"`
+	Resolution     string `json:"resolution"`
+}
+
+// orderEntries returns the entries in the order they must be inserted for the
+// given overlap policy. Entries inserted later take precedence.
+func orderEntries(entries []importEntry, policy string) []importEntry {
+	ordered := make([]importEntry, len(entries))
+	copy(ordered, entries)
+	sort.SliceStable(ordered, func(i, j int) bool {
+		return ordered[i].Index < ordered[j].Index
+	})
+	if policy == overlapSpecific {
+		// Broader networks first so that more specific ones are applied on top.
+		sizes := make(map[int]*big.Int, len(ordered))
+		for _, e := range ordered {
+			sizes[e.Index] = rangeSize(e.Range)
+		}
+		sort.SliceStable(ordered, func(i, j int) bool {
+			return sizes[ordered[i].Index].Cmp(sizes[ordered[j].Index]) > 0
+		})
+	}
+	return ordered
+}
+
+// findOverlaps returns every pair of entries whose networks overlap, in
+// address order. ordered must be the insertion order from orderEntries.
+func findOverlaps(ordered []importEntry, policy, mergeName string) []overlapConflict {
+	rank := make(map[int]int, len(ordered))
+	for i, e := range ordered {
+		rank[e.Index] = i
+	}
+
+	byAddr := make([]importEntry, len(ordered))
+	copy(byAddr, ordered)
+	sort.SliceStable(byAddr, func(i, j int) bool {
+		a, b := treeRange(byAddr[i].Range), treeRange(byAddr[j].Range)
+		if c := a.From().Compare(b.From()); c != 0 {
+			return c < 0
+		}
+		return a.To().Compare(b.To()) > 0
+	})
+
+	var conflicts []overlapConflict
+	var active []importEntry
+	for _, e := range byAddr {
+		r := treeRange(e.Range)
+		kept := active[:0]
+		for _, a := range active {
+			if treeRange(a.Range).To().Compare(r.From()) >= 0 {
+				kept = append(kept, a)
+			}
+		}
+		active = kept
+
+		for _, a := range active {
+			overlap := netipx.IPRangeFrom(r.From(), minAddr(r.To(), treeRange(a.Range).To()))
+			if a.Range.From().Is4() && e.Range.From().Is4() {
+				overlap = netipx.IPRangeFrom(e.Range.From(), minAddr(e.Range.To(), a.Range.To()))
+			}
+			first, second := a, e
+			if first.Index > second.Index {
+				first, second = second, first
+			}
+			last, other := first, second
+			if rank[second.Index] > rank[first.Index] {
+				last, other = second, first
+			}
+			conflicts = append(conflicts, overlapConflict{
+				Source:         e.Source,
+				First:          first.Key,
+				FirstPosition:  first.Index + 1,
+				Second:         second.Key,
+				SecondPosition: second.Index + 1,
+				Overlap:        formatRange(overlap),
+				Winner:         winnerFor(last, mergeName),
+				Resolution:     resolutionFor(last, other, policy, mergeName),
+			})
+		}
+		active = append(active, e)
+	}
+	return conflicts
+}
+
+// winnerFor returns the key whose record ends up in the overlap, or "" when
+// the records are merged.
+func winnerFor(last importEntry, mergeName string) string {
+	if mergeName == "none" {
+		return last.Key
+	}
+	return ""
+}
+
+// resolutionFor describes how an overlap between last and other was
+// resolved, where last is the entry inserted last.
+func resolutionFor(last, other importEntry, policy, mergeName string) string {
+	reason := "later in file"
+	if policy == overlapSpecific && rangeSize(last.Range).Cmp(rangeSize(other.Range)) != 0 {
+		reason = "more specific"
+	}
+	if mergeName == "none" {
+		return fmt.Sprintf("entry %d (%s) wins: %s", last.Index+1, last.Key, reason)
+	}
+	return fmt.Sprintf("merged with %q strategy, entry %d (%s) applied last: %s", mergeName, last.Index+1, last.Key, reason)
+}
+
+// writeConflictReport writes the overlap conflicts as JSON.
+func writeConflictReport(path, policy string, conflicts []overlapConflict) error {
+	report := map[string]interface{}{
+		"policy":    policy,
+		"count":     len(conflicts),
+		"conflicts": conflicts,
+	}
+	if conflicts == nil {
+		report["conflicts"] = []overlapConflict{}
+	}
+	out, err := json.MarshalIndent(report, "", "  ")
+	if err != nil {
+		return err
+	}
+	if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+		return err
+	}
+	return os.WriteFile(path, out, 0644)
+}
+
+// treeRange maps IPv4 ranges into the IPv4 subtree (::/96) so that IPv4 and
+// IPv6 keys can be compared in the same address space.
+func treeRange(r netipx.IPRange) netipx.IPRange {
+	if !r.From().Is4() {
+		return r
+	}
+	return netipx.IPRangeFrom(ipv4ToTree(r.From()), ipv4ToTree(r.To()))
+}
+
+// ipv4ToTree returns the position of an IPv4 address in an IPv6 tree.
+func ipv4ToTree(a netip.Addr) netip.Addr {
+	var b [16]byte
+	v4 := a.As4()
+	copy(b[12:], v4[:])
+	return netip.AddrFrom16(b)
+}
+
+// minAddr returns the lower of two addresses.
+func minAddr(a, b netip.Addr) netip.Addr {
+	if a.Less(b) {
+		return a
+	}
+	return b
+}
+
+// rangeSize returns the number of addresses in r.
+func rangeSize(r netipx.IPRange) *big.Int {
+	from, to := r.From().As16(), r.To().As16()
+	size := new(big.Int).Sub(new(big.Int).SetBytes(to[:]), new(big.Int).SetBytes(from[:]))
+	return size.Add(size, big.NewInt(1))
+}
+
+// formatRange prints a range as a CIDR when it is one, otherwise as "start-end".
+func formatRange(r netipx.IPRange) string {
+	if p, ok := r.Prefix(); ok {
+		return p.String()
+	}
+	return r.String()
+}
@@ -0,0 +1,493 @@
+package cmd
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net"
+	"os"
+	"strings"
+
+	"github.com/maxmind/mmdbwriter"
+	"github.com/maxmind/mmdbwriter/inserter"
+	"github.com/maxmind/mmdbwriter/mmdbtype"
+	"github.com/oschwald/maxminddb-golang"
+	"github.com/spf13/cobra"
+)
+
+// Flags for the patch command.
+var (
+	patchDBPath      string
+	patchFilePath    string
+	patchOutPath     string
+	patchRecordSize  int
+	patchTitle       string
+	patchDescription string
+	patchBuildEpoch  int64
+	patchAlias6to4   bool
+	patchReserved    bool
+	patchForce       bool
+)
+
+// ipv4AliasNetworks are the networks an IPv4-aliased database maps to the
+// IPv4 subtree ::/96.
+var ipv4AliasNetworks = []string{"::ffff:0:0/96", "2001::/32", "2002::/16"}
+
+// Patch operations.
+const (
+	patchOpSet           = "set"
+	patchOpMerge         = "merge"
+	patchOpSetField      = "set-field"
+	patchOpDeleteField   = "delete-field"
+	patchOpRemoveNetwork = "remove-network"
+)
+
+// patchFile is the JSON document read by the patch command. BaseSHA256 is
+// the hash of the database the patch was made for, if known.
+type patchFile struct {
+	BaseSHA256 string           `json:"base_sha256,omitempty"`
+	Metadata   *patchMetadata   `json:"metadata,omitempty"`
+	Operations []patchOperation `json:"operations"`
+}
+
+// patchMetadata lists the metadata fields a patch changes, with the field
+// names of the MMDB metadata section. Fields that are not set keep the value
+// of the original database.
+type patchMetadata struct {
+	BuildEpoch   *int64             `json:"build_epoch,omitempty"`
+	DatabaseType *string            `json:"database_type,omitempty"`
+	Description  *map[string]string `json:"description,omitempty"`
+	IPVersion    *int               `json:"ip_version,omitempty"`
+	Languages    *[]string          `json:"languages,omitempty"`
+	RecordSize   *int               `json:"record_size,omitempty"`
+}
+
+// apply sets the changed metadata fields in opts.
+func (m *patchMetadata) apply(opts *mmdbwriter.Options) error {
+	if m.BuildEpoch != nil {
+		opts.BuildEpoch = *m.BuildEpoch
+	}
+	if m.DatabaseType != nil {
+		opts.DatabaseType = *m.DatabaseType
+	}
+	if m.Description != nil {
+		opts.Description = map[string]string{}
+		for lang, text := range *m.Description {
+			opts.Description[lang] = text
+		}
+	}
+	if m.IPVersion != nil {
+		if *m.IPVersion != 4 && *m.IPVersion != 6 {
+			return fmt.Errorf("ip_version must be 4 or 6")
+		}
+		opts.IPVersion = *m.IPVersion
+	}
+	if m.Languages != nil {
+		// An empty but non-nil list clears the languages on Load
+		opts.Languages = append([]string{}, *m.Languages...)
+	}
+	if m.RecordSize != nil {
+		if *m.RecordSize != 24 && *m.RecordSize != 28 && *m.RecordSize != 32 {
+			return fmt.Errorf("record_size must be 24, 28, or 32")
+		}
+		opts.RecordSize = *m.RecordSize
+	}
+	return nil
+}
+
+// patchOperation is a single change applied to a network or range. Types
+// lists the MMDB types of numbers and bytes in Record or Value, keyed by
+// their path (see encodePatchValue).
+type patchOperation struct {
+	Op      string            `json:"op"`
+	Network string            `json:"network"`
+	Record  interface{}       `json:"record,omitempty"`
+	Field   string            `json:"field,omitempty"`
+	Value   interface{}       `json:"value,omitempty"`
+	Fields  []string          `json:"fields,omitempty"`
+	Types   map[string]string `json:"types,omitempty"`
+}
+
+// patchCmd represents the "patch" command.
+var patchCmd = &cobra.Command{
+	Use:   "patch",
+	Short: "Apply a JSON patch to an existing MMDB file",
+	Long: `
+The "patch" command loads an existing .mmdb file, applies a list of operations
+to it and writes the result to a new file. Records that are not touched keep
+their original MMDB types, and the metadata and record size of the original
+database are kept unless overridden by flags.
+
+───────────────────────────────
+📦 PATCH FORMAT
+───────────────────────────────
+{
+  "base_sha256": "9f2c...",
+  "metadata": {"database_type": "GeoIP2-City", "build_epoch": 1700000000},
+  "operations": [
+    {"op": "set", "network": "1.2.3.0/24", "record": {"proxy_type": "VPN"}},
+    {"op": "merge", "network": "5.6.7.8", "record": {"threat_score": 90}},
+    {"op": "set-field", "network": "5.6.7.0/24",
+     "field": "location.accuracy_radius", "value": 100,
+     "types": {"": "uint16"}},
+    {"op": "delete-field", "network": "10.0.0.0-10.0.0.255",
+     "fields": ["location.city"]},
+    {"op": "remove-network", "network": "192.0.2.0/24"}
+  ]
+}
+
+Operations are applied in order:
+  set              Replace the record of every address in the network
+  merge            Deep-merge the record into the existing records
+  set-field        Set one field (a dot-separated path) in existing records
+  delete-field     Remove fields (dot-separated paths) from existing records
+  remove-network   Remove the network and its data from the database
+
+Numbers are stored as doubles unless "types" gives their MMDB type
+(uint16, uint32, uint64, uint128, int32, float32, or bytes for base64
+strings), keyed by their path in the record or value, with "" for the value
+itself and array indexes as path segments (e.g. "subdivisions.0.geoname_id").
+"diff --patch-out" writes patches in this format.
+
+If the patch has a base_sha256, it is only applied to the database with
+that SHA-256, so it is never applied to the wrong base. --force skips the
+check.
+
+Networks may be CIDR blocks, single IPs or "start-end" ranges.
+
+The optional "metadata" section changes metadata fields of the original
+database: build_epoch, database_type, description (a map of language to
+text, which replaces all descriptions), ip_version, languages and
+record_size. Fields that are not listed are kept. The flags below take
+precedence over the section.
+
+The build epoch of the original database is kept unless --build-epoch or
+the metadata section gives one. IPv6 to IPv4 aliasing and whether reserved networks may hold data
+are detected from the original database and kept, unless --alias-6to4 or
+--disallow-reserved is given (use --alias-6to4=false to turn aliasing
+off). Aliasing can only be detected when the database has IPv4 data.
+
+───────────────────────────────
+ EXAMPLE
+───────────────────────────────
+$ mmdbio patch --db base.mmdb --patch changes.json --out new.mmdb
+`,
+	RunE: func(cmd *cobra.Command, args []string) error {
+		if patchDBPath == "" || patchFilePath == "" || patchOutPath == "" {
+			return fmt.Errorf("--db, --patch and --out are required")
+		}
+
+		raw, err := os.ReadFile(patchFilePath)
+		if err != nil {
+			return fmt.Errorf("failed to read patch: %v", err)
+		}
+		var patch patchFile
+		dec := json.NewDecoder(bytes.NewReader(raw))
+		dec.UseNumber()
+		if err := dec.Decode(&patch); err != nil {
+			return fmt.Errorf("failed to parse patch: %v", err)
+		}
+
+		if patch.BaseSHA256 != "" {
+			sum, _, err := hashFile(patchDBPath)
+			if err != nil {
+				return fmt.Errorf("failed to hash db: %v", err)
+			}
+			if !strings.EqualFold(sum, patch.BaseSHA256) {
+				if !patchForce {
+					return fmt.Errorf("patch was made for a database with SHA-256 %s, but %s has %s (use --force to apply anyway)",
+						patch.BaseSHA256, patchDBPath, sum)
+				}
+				fmt.Fprintf(os.Stderr, "warn: %s does not match the patch base SHA-256, applying anyway\n", patchDBPath)
+			}
+		}
+
+		// Read the original metadata and options so individual ones can be
+		// overridden
+		db, err := maxminddb.Open(patchDBPath)
+		if err != nil {
+			return fmt.Errorf("failed to open db: %v", err)
+		}
+		meta := db.Metadata
+		aliased, err := hasIPv4Aliases(db)
+		if err != nil {
+			db.Close()
+			return fmt.Errorf("failed to read db: %v", err)
+		}
+		reserved, err := hasReservedNetworks(db)
+		db.Close()
+		if err != nil {
+			return fmt.Errorf("failed to read db: %v", err)
+		}
+
+		opts := mmdbwriter.Options{
+			BuildEpoch:              int64(meta.BuildEpoch),
+			DisableIPv4Aliasing:     !aliased,
+			IncludeReservedNetworks: !reserved,
+		}
+		if patch.Metadata != nil {
+			if err := patch.Metadata.apply(&opts); err != nil {
+				return fmt.Errorf("invalid patch metadata: %v", err)
+			}
+		}
+		if cmd.Flags().Changed("alias-6to4") {
+			opts.DisableIPv4Aliasing = !patchAlias6to4
+		}
+		if cmd.Flags().Changed("disallow-reserved") {
+			opts.IncludeReservedNetworks = !patchReserved
+		}
+		if cmd.Flags().Changed("size") {
+			if patchRecordSize != 24 && patchRecordSize != 28 && patchRecordSize != 32 {
+				return fmt.Errorf("--size must be 24, 28, or 32")
+			}
+			opts.RecordSize = patchRecordSize
+		}
+		if cmd.Flags().Changed("title") {
+			opts.DatabaseType = patchTitle
+		}
+		if cmd.Flags().Changed("description") {
+			base := meta.Description
+			if opts.Description != nil {
+				base = opts.Description
+			}
+			desc := map[string]string{}
+			for lang, d := range base {
+				desc[lang] = d
+			}
+			desc["en"] = patchDescription
+			opts.Description = desc
+		}
+		if cmd.Flags().Changed("build-epoch") {
+			opts.BuildEpoch = patchBuildEpoch
+		}
+
+		tree, err := mmdbwriter.Load(patchDBPath, opts)
+		if err != nil {
+			return fmt.Errorf("failed to load db: %v", err)
+		}
+		if aliased && opts.DisableIPv4Aliasing {
+			// Load copies the aliased networks as data; drop them instead of
+			// keeping a stale copy of the IPv4 data.
+			for _, cidr := range ipv4AliasNetworks {
+				_, network, _ := net.ParseCIDR(cidr)
+				if err := tree.InsertFunc(network, inserter.Remove); err != nil {
+					return fmt.Errorf("failed to remove alias %s: %v", cidr, err)
+				}
+			}
+		}
+
+		for i, op := range patch.Operations {
+			if err := applyPatchOperation(tree, op); err != nil {
+				return fmt.Errorf("operation %d (%s %s): %v", i+1, op.Op, op.Network, err)
+			}
+		}
+
+		if err := writeTree(tree, patchOutPath, opts.BuildEpoch); err != nil {
+			return err
+		}
+
+		fmt.Fprintf(os.Stderr, "✅ Applied %d operations to %s and wrote %s\n", len(patch.Operations), patchDBPath, patchOutPath)
+		return nil
+	},
+}
+
+// hasIPv4Aliases reports whether db maps ::ffff:0:0/96 to its IPv4 subtree,
+// as databases written with --alias-6to4 do. Aliased networks are only
+// visited when SkipAliasedNetworks is not given, so such a database has
+// networks there that the option skips.
+func hasIPv4Aliases(db *maxminddb.Reader) (bool, error) {
+	if db.Metadata.IPVersion != 6 {
+		return false, nil
+	}
+	count := func(opts ...maxminddb.NetworksOption) (int, error) {
+		n := 0
+		_, alias, _ := net.ParseCIDR(ipv4AliasNetworks[0])
+		networks := db.NetworksWithin(alias, opts...)
+		for networks.Next() {
+			n++
+		}
+		return n, networks.Err()
+	}
+	all, err := count()
+	if err != nil || all == 0 {
+		return false, err
+	}
+	unaliased, err := count(maxminddb.SkipAliasedNetworks)
+	return unaliased == 0, err
+}
+
+// hasReservedNetworks reports whether db was written with reserved networks
+// kept free of data, as import --disallow-reserved does. mmdbwriter leaves
+// such a network as an empty record of exactly its size, so every reserved
+// network among the bogons must look up as no data in a network of that
+// size. Other databases rarely match by chance.
+func hasReservedNetworks(db *maxminddb.Reader) (bool, error) {
+	probe, err := mmdbwriter.New(mmdbwriter.Options{
+		IPVersion:           int(db.Metadata.IPVersion),
+		DisableIPv4Aliasing: true,
+	})
+	if err != nil {
+		return false, err
+	}
+	keep := func(existing mmdbtype.DataType) (mmdbtype.DataType, error) { return existing, nil }
+
+	checked := 0
+	for _, cidr := range bogonNetworks {
+		_, network, err := net.ParseCIDR(cidr)
+		if err != nil {
+			return false, err
+		}
+		if db.Metadata.IPVersion == 4 && network.IP.To4() == nil {
+			continue
+		}
+		var reservedErr *mmdbwriter.ReservedNetworkError
+		if err := probe.InsertFunc(network, keep); !errors.As(err, &reservedErr) {
+			continue
+		}
+		reserved, _ := probe.Get(network.IP)
+
+		var record interface{}
+		got, ok, err := db.LookupNetwork(network.IP, &record)
+		if err != nil {
+			return false, err
+		}
+		if ok || familyPrefixLen(got) != familyPrefixLen(reserved) {
+			return false, nil
+		}
+		checked++
+	}
+	return checked > 0, nil
+}
+
+// familyPrefixLen returns the prefix length of n within its address family,
+// so that IPv4 networks compare equal whether or not they are given in the
+// IPv6 tree.
+func familyPrefixLen(n *net.IPNet) int {
+	ones, bits := n.Mask.Size()
+	if bits == 128 && n.IP.To4() != nil {
+		return ones - 96
+	}
+	return ones
+}
+
+// applyPatchOperation applies op to every prefix of its network.
+func applyPatchOperation(tree *mmdbwriter.Tree, op patchOperation) error {
+	r, warning, err := parseNetworkKey(op.Network)
+	if err != nil {
+		return err
+	}
+	if warning != "" {
+		fmt.Fprintf(os.Stderr, "warn: %s\n", warning)
+	}
+
+	var fn inserter.Func
+	switch op.Op {
+	case patchOpSet, patchOpMerge:
+		if op.Record == nil {
+			return fmt.Errorf("record is required")
+		}
+		value, err := decodePatchValue(op.Record, op.Types)
+		if err != nil {
+			return err
+		}
+		if op.Op == patchOpSet {
+			fn = inserter.ReplaceWith(value)
+		} else {
+			fn = inserter.DeepMergeWith(value)
+		}
+	case patchOpSetField:
+		if op.Field == "" {
+			return fmt.Errorf("field is required")
+		}
+		value, err := decodePatchValue(op.Value, op.Types)
+		if err != nil {
+			return err
+		}
+		fn = setFieldFunc(strings.Split(op.Field, "."), value)
+	case patchOpDeleteField:
+		if len(op.Fields) == 0 {
+			return fmt.Errorf("fields are required")
+		}
+		fn = deleteFieldsFunc(op.Fields)
+	case patchOpRemoveNetwork:
+		fn = inserter.Remove
+	default:
+		return fmt.Errorf("unknown op, must be one of: set, merge, set-field, delete-field, remove-network")
+	}
+
+	for _, network := range rangeIPNets(r) {
+		if err := tree.InsertFunc(network, fn); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// setFieldFunc returns an inserter function that sets the field at keys to
+// value, creating the record and intermediate maps as needed.
+func setFieldFunc(keys []string, value mmdbtype.DataType) inserter.Func {
+	return func(existing mmdbtype.DataType) (mmdbtype.DataType, error) {
+		record, ok := existing.(mmdbtype.Map)
+		if ok {
+			record = record.Copy().(mmdbtype.Map)
+		} else {
+			record = mmdbtype.Map{}
+		}
+		m := record
+		for _, key := range keys[:len(keys)-1] {
+			child, ok := m[mmdbtype.String(key)].(mmdbtype.Map)
+			if !ok {
+				child = mmdbtype.Map{}
+				m[mmdbtype.String(key)] = child
+			}
+			m = child
+		}
+		m[mmdbtype.String(keys[len(keys)-1])] = value
+		return record, nil
+	}
+}
+
+// deleteFieldsFunc returns an inserter function that removes the given
+// dot-separated field paths from existing map records.
+func deleteFieldsFunc(paths []string) inserter.Func {
+	return func(existing mmdbtype.DataType) (mmdbtype.DataType, error) {
+		record, ok := existing.(mmdbtype.Map)
+		if !ok {
+			return existing, nil
+		}
+		record = record.Copy().(mmdbtype.Map)
+		for _, path := range paths {
+			deleteMapPath(record, strings.Split(path, "."))
+		}
+		return record, nil
+	}
+}
+
+// deleteMapPath removes the value at keys from m, if present.
+func deleteMapPath(m mmdbtype.Map, keys []string) {
+	if len(keys) == 1 {
+		delete(m, mmdbtype.String(keys[0]))
+		return
+	}
+	child, ok := m[mmdbtype.String(keys[0])].(mmdbtype.Map)
+	if !ok {
+		return
+	}
+	deleteMapPath(child, keys[1:])
+}
+
+func init() {
+	rootCmd.AddCommand(patchCmd)
+
+	patchCmd.Flags().StringVar(&patchDBPath, "db", "", "Path to the .mmdb file to patch")
+	patchCmd.Flags().StringVar(&patchFilePath, "patch", "", "Path to the JSON patch file")
+	patchCmd.Flags().StringVarP(&patchOutPath, "out", "o", "", "Output .mmdb file path")
+	patchCmd.Flags().IntVar(&patchRecordSize, "size", 0, "Record size (24, 28, or 32) (defaults to the original)")
+	patchCmd.Flags().StringVarP(&patchTitle, "title", "t", "", "Title (database_type) (defaults to the original)")
+	patchCmd.Flags().StringVarP(&patchDescription, "description", "d", "", "English description (defaults to the original)")
+	patchCmd.Flags().Int64Var(&patchBuildEpoch, "build-epoch", 0, "Build time as a Unix timestamp (defaults to the original)")
+	patchCmd.Flags().BoolVar(&patchAlias6to4, "alias-6to4", false, "Enable IPv6 to IPv4 aliasing (defaults to the original)")
+	patchCmd.Flags().BoolVar(&patchReserved, "disallow-reserved", false, "Disallow data in reserved IP ranges (defaults to the original)")
+	patchCmd.Flags().BoolVar(&patchForce, "force", false, "Apply the patch even if the database does not match its base_sha256")
+}
@@ -0,0 +1,193 @@
+package cmd
+
+import (
+	"encoding/base64"
+	"encoding/json"
+	"fmt"
+	"math/big"
+	"sort"
+	"strconv"
+
+	"github.com/maxmind/mmdbwriter/mmdbtype"
+)
+
+// MMDB types that a plain JSON value does not imply. In a patch they are
+// listed in the "types" of an operation, keyed by the path of the value
+// within the record, with array elements as numeric path segments.
+const (
+	typeUint16  = "uint16"
+	typeUint32  = "uint32"
+	typeUint64  = "uint64"
+	typeUint128 = "uint128"
+	typeInt32   = "int32"
+	typeFloat32 = "float32"
+	typeBytes   = "bytes"
+)
+
+// encodePatchValue converts v to plain JSON and returns the types of the
+// values that would otherwise be read back as strings or doubles.
+func encodePatchValue(v mmdbtype.DataType) (interface{}, map[string]string) {
+	types := map[string]string{}
+	out := encodeTypedValue(v, "", types)
+	if len(types) == 0 {
+		types = nil
+	}
+	return out, types
+}
+
+func encodeTypedValue(v mmdbtype.DataType, path string, types map[string]string) interface{} {
+	child := func(key string) string {
+		if path == "" {
+			return key
+		}
+		return path + "." + key
+	}
+
+	switch t := v.(type) {
+	case mmdbtype.Map:
+		keys := make([]string, 0, len(t))
+		for k := range t {
+			keys = append(keys, string(k))
+		}
+		sort.Strings(keys)
+		m := make(map[string]interface{}, len(t))
+		for _, k := range keys {
+			m[k] = encodeTypedValue(t[mmdbtype.String(k)], child(k), types)
+		}
+		return m
+	case mmdbtype.Slice:
+		s := make([]interface{}, len(t))
+		for i, e := range t {
+			s[i] = encodeTypedValue(e, child(strconv.Itoa(i)), types)
+		}
+		return s
+	case mmdbtype.String:
+		return string(t)
+	case mmdbtype.Bool:
+		return bool(t)
+	case mmdbtype.Float64:
+		return float64(t)
+	case mmdbtype.Float32:
+		types[path] = typeFloat32
+		return float64(t)
+	case mmdbtype.Uint16:
+		types[path] = typeUint16
+		return json.Number(strconv.FormatUint(uint64(t), 10))
+	case mmdbtype.Uint32:
+		types[path] = typeUint32
+		return json.Number(strconv.FormatUint(uint64(t), 10))
+	case mmdbtype.Uint64:
+		types[path] = typeUint64
+		return json.Number(strconv.FormatUint(uint64(t), 10))
+	case mmdbtype.Int32:
+		types[path] = typeInt32
+		return json.Number(strconv.FormatInt(int64(t), 10))
+	case *mmdbtype.Uint128:
+		types[path] = typeUint128
+		return json.Number((*big.Int)(t).String())
+	case mmdbtype.Bytes:
+		types[path] = typeBytes
+		return base64.StdEncoding.EncodeToString(t)
+	default:
+		return nil
+	}
+}
+
+// decodePatchValue converts a JSON value read with UseNumber to mmdbtype,
+// applying the types listed for its paths. Values without a listed type are
+// converted as by import: numbers become doubles and null an empty string.
+func decodePatchValue(v interface{}, types map[string]string) (mmdbtype.DataType, error) {
+	return decodeTypedValue(v, "", types)
+}
+
+func decodeTypedValue(v interface{}, path string, types map[string]string) (mmdbtype.DataType, error) {
+	child := func(key string) string {
+		if path == "" {
+			return key
+		}
+		return path + "." + key
+	}
+
+	typ := types[path]
+	switch t := v.(type) {
+	case map[string]interface{}:
+		m := make(mmdbtype.Map, len(t))
+		for k, e := range t {
+			conv, err := decodeTypedValue(e, child(k), types)
+			if err != nil {
+				return nil, err
+			}
+			m[mmdbtype.String(k)] = conv
+		}
+		return m, nil
+	case []interface{}:
+		s := make(mmdbtype.Slice, len(t))
+		for i, e := range t {
+			conv, err := decodeTypedValue(e, child(strconv.Itoa(i)), types)
+			if err != nil {
+				return nil, err
+			}
+			s[i] = conv
+		}
+		return s, nil
+	case json.Number:
+		return decodeTypedNumber(string(t), path, typ)
+	case string:
+		if typ == typeBytes {
+			b, err := base64.StdEncoding.DecodeString(t)
+			if err != nil {
+				return nil, fmt.Errorf("%s: invalid bytes: %v", path, err)
+			}
+			return mmdbtype.Bytes(b), nil
+		}
+		return mmdbtype.String(t), nil
+	default:
+		return convertToMMDBType(v, nullEmpty)
+	}
+}
+
+// decodeTypedNumber parses a JSON number as the given MMDB type.
+func decodeTypedNumber(n, path, typ string) (mmdbtype.DataType, error) {
+	var (
+		v   mmdbtype.DataType
+		err error
+	)
+	switch typ {
+	case typeUint16:
+		var u uint64
+		u, err = strconv.ParseUint(n, 10, 16)
+		v = mmdbtype.Uint16(u)
+	case typeUint32:
+		var u uint64
+		u, err = strconv.ParseUint(n, 10, 32)
+		v = mmdbtype.Uint32(u)
+	case typeUint64:
+		var u uint64
+		u, err = strconv.ParseUint(n, 10, 64)
+		v = mmdbtype.Uint64(u)
+	case typeInt32:
+		var i int64
+		i, err = strconv.ParseInt(n, 10, 32)
+		v = mmdbtype.Int32(i)
+	case typeUint128:
+		b, ok := new(big.Int).SetString(n, 10)
+		if !ok || b.Sign() < 0 || b.BitLen() > 128 {
+			return nil, fmt.Errorf("%s: invalid uint128 %s", path, n)
+		}
+		v = (*mmdbtype.Uint128)(b)
+	case typeFloat32:
+		var f float64
+		f, err = strconv.ParseFloat(n, 32)
+		v = mmdbtype.Float32(f)
+	case "":
+		var f float64
+		f, err = strconv.ParseFloat(n, 64)
+		v = mmdbtype.Float64(f)
+	default:
+		return nil, fmt.Errorf("%s: unknown type %q", path, typ)
+	}
+	if err != nil {
+		return nil, fmt.Errorf("%s: invalid %s: %v", path, typ, err)
+	}
+	return v, nil
+}
@@ -0,0 +1,217 @@
+package cmd
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"log"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"text/tabwriter"
+
+	"github.com/oschwald/maxminddb-golang"
+)
+
+// schemaExampleLength is the longest example value printed by inspect --scan.
+const schemaExampleLength = 60
+
+// schemaField is what a schema scan found about one field path.
+type schemaField struct {
+	Path    string         `json:"path"`
+	Types   map[string]int `json:"types"`
+	Present int            `json:"present"`
+	Example interface{}    `json:"example,omitempty"`
+	// Values counts every occurrence, including each element of arrays,
+	// and Pointers those stored behind a pointer.
+	Values   int `json:"values"`
+	Pointers int `json:"pointers"`
+	// MinSize and MaxSize are the fewest and most entries of a map or
+	// array seen at the path.
+	MinSize *int `json:"min_size,omitempty"`
+	MaxSize *int `json:"max_size,omitempty"`
+
+	// lastRecord and typeRecord make every record count at most once.
+	lastRecord int
+	typeRecord map[string]int
+}
+
+// schemaScan merges the structure of many records. Array elements share
+// the path of their array followed by "[]".
+type schemaScan struct {
+	Networks int
+	Records  int
+	fields   map[string]*schemaField
+}
+
+// newSchemaScan returns an empty scan.
+func newSchemaScan() *schemaScan {
+	return &schemaScan{fields: map[string]*schemaField{}}
+}
+
+// startRecord starts counting the values of the next record.
+func (s *schemaScan) startRecord() {
+	s.Records++
+}
+
+// visit merges one value of the current record. The record itself is
+// only counted when it is not a map.
+func (s *schemaScan) visit(v wireValue) {
+	if v.Path == "" && v.Type == wireMap {
+		return
+	}
+	var example interface{}
+	if v.Value != nil {
+		example, _ = encodePatchValue(v.Value)
+	}
+	f := s.add(v.Path, v.Type, example)
+	f.Values++
+	if v.Pointer {
+		f.Pointers++
+	}
+	if v.Type == wireMap || v.Type == wireArray {
+		if f.MinSize == nil || v.Size < *f.MinSize {
+			size := v.Size
+			f.MinSize = &size
+		}
+		if f.MaxSize == nil || v.Size > *f.MaxSize {
+			size := v.Size
+			f.MaxSize = &size
+		}
+	}
+}
+
+// add counts a value of typ at path in the current record.
+func (s *schemaScan) add(path, typ string, example interface{}) *schemaField {
+	f, ok := s.fields[path]
+	if !ok {
+		f = &schemaField{Path: path, Types: map[string]int{}, typeRecord: map[string]int{}}
+		s.fields[path] = f
+	}
+	if f.lastRecord != s.Records {
+		f.lastRecord = s.Records
+		f.Present++
+	}
+	if f.typeRecord[typ] != s.Records {
+		f.typeRecord[typ] = s.Records
+		f.Types[typ]++
+	}
+	if f.Example == nil && example != nil {
+		f.Example = example
+	}
+	return f
+}
+
+// sortedFields returns the fields in path order.
+func (s *schemaScan) sortedFields() []*schemaField {
+	out := make([]*schemaField, 0, len(s.fields))
+	for _, f := range s.fields {
+		out = append(out, f)
+	}
+	sort.Slice(out, func(i, j int) bool { return out[i].Path < out[j].Path })
+	return out
+}
+
+// scanSchema walks the networks of db and merges the structure of their
+// records, with the MMDB type every value is stored with. With fraction
+// below 1 only an evenly spread share of the networks is decoded.
+func scanSchema(db *maxminddb.Reader, fraction float64) (*schemaScan, error) {
+	scan := newSchemaScan()
+	dec := &mmdbValueDecoder{visit: scan.visit, collapseArrays: true}
+	networks := db.Networks(maxminddb.SkipAliasedNetworks)
+	for networks.Next() {
+		i := scan.Networks
+		scan.Networks++
+		if int(float64(i+1)*fraction) == int(float64(i)*fraction) {
+			continue
+		}
+		scan.startRecord()
+		if _, err := networks.Network(dec); err != nil {
+			return nil, err
+		}
+		dec.decodeTyped()
+	}
+	return scan, networks.Err()
+}
+
+// printSchemaScan prints one line per field: its path, the types seen with
+// the most common first, how many records have it, the entries of maps and
+// arrays, how many values are stored behind pointers and an example value.
+func printSchemaScan(w io.Writer, name string, scan *schemaScan) {
+	fmt.Fprintf(w, "📂 Schema of %s: %d of %d networks scanned\n", name, scan.Records, scan.Networks)
+	fmt.Fprintln(w, "────────────────────────────────────────────")
+	if scan.Records == 0 {
+		fmt.Fprintln(w, "No records found.")
+		return
+	}
+
+	tw := tabwriter.NewWriter(w, 0, 0, 2, ' ', 0)
+	fmt.Fprintln(tw, "PATH\tTYPES\tPRESENT\tSIZE\tPOINTERS\tEXAMPLE")
+	for _, f := range scan.sortedFields() {
+		path := f.Path
+		if path == "" {
+			path = "(record)"
+		}
+		example := ""
+		if f.Example != nil {
+			example = compactJSON(f.Example)
+			// Cut at a rune, so that multi-byte characters stay intact
+			if runes := []rune(example); len(runes) > schemaExampleLength {
+				example = string(runes[:schemaExampleLength-3]) + "..."
+			}
+		}
+		size := "-"
+		if f.MinSize != nil {
+			size = fmt.Sprint(*f.MinSize)
+			if *f.MaxSize != *f.MinSize {
+				size += fmt.Sprintf("-%d", *f.MaxSize)
+			}
+		}
+		fmt.Fprintf(tw, "%s\t%s\t%.1f%%\t%s\t%.1f%%\t%s\n", path, formatSchemaTypes(f.Types), 100*float64(f.Present)/float64(scan.Records),
+			size, 100*float64(f.Pointers)/float64(f.Values), example)
+	}
+	tw.Flush()
+}
+
+// formatSchemaTypes lists types by how many records they were seen in.
+func formatSchemaTypes(types map[string]int) string {
+	names := make([]string, 0, len(types))
+	for t := range types {
+		names = append(names, t)
+	}
+	sort.Slice(names, func(i, j int) bool {
+		if types[names[i]] != types[names[j]] {
+			return types[names[i]] > types[names[j]]
+		}
+		return names[i] < names[j]
+	})
+	return strings.Join(names, "|")
+}
+
+// saveSchemaScanJSON writes the scan result as JSON.
+func saveSchemaScanJSON(path string, scan *schemaScan) {
+	type field struct {
+		*schemaField
+		Presence float64 `json:"presence"`
+	}
+	fields := []field{}
+	for _, f := range scan.sortedFields() {
+		fields = append(fields, field{schemaField: f, Presence: float64(f.Present) / float64(scan.Records)})
+	}
+	out, err := json.MarshalIndent(map[string]interface{}{
+		"networks":        scan.Networks,
+		"records_scanned": scan.Records,
+		"fields":          fields,
+	}, "", "  ")
+	if err != nil {
+		log.Fatalf("Failed to encode schema: %v", err)
+	}
+	if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+		log.Fatalf("Failed to create directories: %v", err)
+	}
+	if err := os.WriteFile(path, out, 0644); err != nil {
+		log.Fatalf("Failed to write schema file: %v", err)
+	}
+	fmt.Printf("\n✅ Schema exported to: %s\n", path)
+}
@@ -0,0 +1,88 @@
+package cmd
+
+import (
+	"fmt"
+	"os"
+
+	"github.com/spf13/cobra"
+)
+
+// Flags for the sign command.
+var (
+	signDBPath   string
+	signKeyPath  string
+	signPubPath  string
+	signOutPath  string
+	signGenerate bool
+)
+
+// signCmd represents the "sign" command.
+var signCmd = &cobra.Command{
+	Use:   "sign",
+	Short: "Sign an MMDB file with an Ed25519 key",
+	Long: `
+The "sign" command writes a detached Ed25519 signature over the whole .mmdb
+file, so appliances can detect a tampered or corrupted database with
+"verify --pubkey". The signature is stored as raw 64 bytes in <db>.sig
+unless --out is given.
+
+Keys are PEM files: the private key in PKCS #8 and the public key in PKIX
+format, the same as "openssl genpkey -algorithm ed25519". --generate
+creates a new key pair at --key and --pubkey instead of signing.
+
+───────────────────────────────
+ EXAMPLES
+───────────────────────────────
+$ mmdbio sign --generate --key signing.key --pubkey signing.pub
+$ mmdbio sign --db threats.mmdb --key signing.key
+$ mmdbio verify --db threats.mmdb --pubkey signing.pub
+
+The signature can also be checked with OpenSSL:
+$ openssl pkeyutl -verify -pubin -inkey signing.pub -rawin \
+    -in threats.mmdb -sigfile threats.mmdb.sig
+`,
+	RunE: func(cmd *cobra.Command, args []string) error {
+		if signKeyPath == "" {
+			return fmt.Errorf("--key is required")
+		}
+
+		if signGenerate {
+			if signPubPath == "" {
+				return fmt.Errorf("--pubkey is required with --generate")
+			}
+			pub, err := generateKeyPair(signKeyPath, signPubPath)
+			if err != nil {
+				return err
+			}
+			fmt.Fprintf(os.Stderr, "✅ Wrote key pair %s and %s (fingerprint %s)\n", signKeyPath, signPubPath, keyFingerprint(pub))
+			return nil
+		}
+
+		if signDBPath == "" {
+			return fmt.Errorf("--db is required")
+		}
+		key, err := loadPrivateKey(signKeyPath)
+		if err != nil {
+			return err
+		}
+		sigPath := signOutPath
+		if sigPath == "" {
+			sigPath = signDBPath + signatureSuffix
+		}
+		if err := signFile(signDBPath, sigPath, key); err != nil {
+			return err
+		}
+		fmt.Fprintf(os.Stderr, "✅ Signed %s, signature written to %s\n", signDBPath, sigPath)
+		return nil
+	},
+}
+
+func init() {
+	rootCmd.AddCommand(signCmd)
+
+	signCmd.Flags().StringVar(&signDBPath, "db", "", "Path to the .mmdb file to sign")
+	signCmd.Flags().StringVar(&signKeyPath, "key", "", "Ed25519 private key (PEM, PKCS #8)")
+	signCmd.Flags().StringVar(&signPubPath, "pubkey", "", "Public key path for --generate (PEM, PKIX)")
+	signCmd.Flags().StringVarP(&signOutPath, "out", "o", "", "Signature output path (defaults to <db>.sig)")
+	signCmd.Flags().BoolVar(&signGenerate, "generate", false, "Generate a new key pair instead of signing")
+}
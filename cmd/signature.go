@@ -0,0 +1,179 @@
+package cmd
+
+import (
+	"crypto/ed25519"
+	"crypto/rand"
+	"crypto/sha256"
+	"crypto/x509"
+	"encoding/hex"
+	"encoding/pem"
+	"errors"
+	"fmt"
+	"io/fs"
+	"os"
+)
+
+// signatureSuffix is appended to a database path to get the path of its
+// detached signature.
+const signatureSuffix = ".sig"
+
+// errBadSignature is wrapped by verifyFileSignature when the signature is
+// not valid for the file, as opposed to the signature not being readable.
+var errBadSignature = errors.New("bad signature")
+
+// errNoSignature is wrapped by verifyFileSignature when the signature file
+// is missing or cannot be read.
+var errNoSignature = errors.New("missing signature")
+
+// loadPrivateKey reads an Ed25519 private key from a PEM encoded PKCS #8 file,
+// as written by "sign --generate" or "openssl genpkey -algorithm ed25519".
+func loadPrivateKey(path string) (ed25519.PrivateKey, error) {
+	der, err := readPEM(path, "PRIVATE KEY")
+	if err != nil {
+		return nil, err
+	}
+	key, err := x509.ParsePKCS8PrivateKey(der)
+	if err != nil {
+		return nil, fmt.Errorf("failed to parse private key %s: %v", path, err)
+	}
+	edKey, ok := key.(ed25519.PrivateKey)
+	if !ok {
+		return nil, fmt.Errorf("%s is not an Ed25519 private key", path)
+	}
+	return edKey, nil
+}
+
+// loadPublicKey reads an Ed25519 public key from a PEM encoded PKIX file.
+func loadPublicKey(path string) (ed25519.PublicKey, error) {
+	der, err := readPEM(path, "PUBLIC KEY")
+	if err != nil {
+		return nil, err
+	}
+	key, err := x509.ParsePKIXPublicKey(der)
+	if err != nil {
+		return nil, fmt.Errorf("failed to parse public key %s: %v", path, err)
+	}
+	edKey, ok := key.(ed25519.PublicKey)
+	if !ok {
+		return nil, fmt.Errorf("%s is not an Ed25519 public key", path)
+	}
+	return edKey, nil
+}
+
+// readPEM returns the bytes of the first PEM block of the given type in path.
+func readPEM(path, blockType string) ([]byte, error) {
+	raw, err := os.ReadFile(path)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read key: %v", err)
+	}
+	for {
+		var block *pem.Block
+		block, raw = pem.Decode(raw)
+		if block == nil {
+			return nil, fmt.Errorf("no %s PEM block found in %s", blockType, path)
+		}
+		if block.Type == blockType {
+			return block.Bytes, nil
+		}
+	}
+}
+
+// generateKeyPair writes a new Ed25519 key pair to privPath and pubPath.
+// The private key is only readable by its owner. Existing files are never
+// overwritten, so an existing signing key cannot be lost.
+func generateKeyPair(privPath, pubPath string) (ed25519.PublicKey, error) {
+	pub, priv, err := ed25519.GenerateKey(rand.Reader)
+	if err != nil {
+		return nil, err
+	}
+	privDER, err := x509.MarshalPKCS8PrivateKey(priv)
+	if err != nil {
+		return nil, err
+	}
+	pubDER, err := x509.MarshalPKIXPublicKey(pub)
+	if err != nil {
+		return nil, err
+	}
+
+	privFile, err := createNewFile(privPath, 0600)
+	if err != nil {
+		return nil, fmt.Errorf("failed to create private key: %v", err)
+	}
+	defer privFile.Close()
+	pubFile, err := createNewFile(pubPath, 0644)
+	if err != nil {
+		// Nothing was written to the private key file yet.
+		privFile.Close()
+		os.Remove(privPath)
+		return nil, fmt.Errorf("failed to create public key: %v", err)
+	}
+	defer pubFile.Close()
+
+	if err := pem.Encode(privFile, &pem.Block{Type: "PRIVATE KEY", Bytes: privDER}); err != nil {
+		return nil, fmt.Errorf("failed to write private key: %v", err)
+	}
+	if err := pem.Encode(pubFile, &pem.Block{Type: "PUBLIC KEY", Bytes: pubDER}); err != nil {
+		return nil, fmt.Errorf("failed to write public key: %v", err)
+	}
+	if err := privFile.Close(); err != nil {
+		return nil, fmt.Errorf("failed to write private key: %v", err)
+	}
+	if err := pubFile.Close(); err != nil {
+		return nil, fmt.Errorf("failed to write public key: %v", err)
+	}
+	return pub, nil
+}
+
+// createNewFile creates path for writing and fails if it already exists.
+func createNewFile(path string, perm os.FileMode) (*os.File, error) {
+	f, err := os.OpenFile(path, os.O_WRONLY|os.O_CREATE|os.O_EXCL, perm)
+	if errors.Is(err, fs.ErrExist) {
+		return nil, fmt.Errorf("%s already exists, refusing to overwrite it", path)
+	}
+	return f, err
+}
+
+// keyFingerprint returns the hex SHA-256 of the PKIX encoding of pub.
+func keyFingerprint(pub ed25519.PublicKey) string {
+	der, err := x509.MarshalPKIXPublicKey(pub)
+	if err != nil {
+		return ""
+	}
+	sum := sha256.Sum256(der)
+	return hex.EncodeToString(sum[:])
+}
+
+// signFile writes a detached Ed25519 signature over the contents of path to
+// sigPath. The signature is the raw 64 bytes, as produced by
+// "openssl pkeyutl -sign -rawin".
+func signFile(path, sigPath string, key ed25519.PrivateKey) error {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return fmt.Errorf("failed to read %s: %v", path, err)
+	}
+	sig := ed25519.Sign(key, data)
+	if err := os.WriteFile(sigPath, sig, 0644); err != nil {
+		return fmt.Errorf("failed to write signature: %v", err)
+	}
+	return nil
+}
+
+// verifyFileSignature checks the detached signature in sigPath over the
+// contents of path.
+func verifyFileSignature(path, sigPath string, pub ed25519.PublicKey) error {
+	sig, err := os.ReadFile(sigPath)
+	if err != nil {
+		return fmt.Errorf("%w: failed to read %s: %v", errNoSignature, sigPath, err)
+	}
+	if len(sig) != ed25519.SignatureSize {
+		return fmt.Errorf("%w: %s is not an Ed25519 signature (%d bytes, want %d)", errBadSignature, sigPath, len(sig), ed25519.SignatureSize)
+	}
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return fmt.Errorf("failed to read %s: %v", path, err)
+	}
+	if !ed25519.Verify(pub, data, sig) {
+		return fmt.Errorf("%w: signature does not match %s", errBadSignature, path)
+	}
+	return nil
+}
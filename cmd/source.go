@@ -0,0 +1,272 @@
+package cmd
+
+import (
+	"bufio"
+	"encoding/csv"
+	"encoding/json"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+)
+
+// Input formats accepted by import.
+const (
+	formatJSON   = "json"
+	formatNDJSON = "ndjson"
+	formatList   = "list"
+	formatCSV    = "csv"
+)
+
+// defaultListRecord is the record template used for list inputs when
+// --record is not given.
+const defaultListRecord = `{"source": "{{name}}"}`
+
+// readEntries reads the entries of an import source in the given format.
+// record is the record template for list inputs.
+func readEntries(path, format, record string) ([]importEntry, error) {
+	switch format {
+	case formatJSON:
+		return readJSONEntries(path)
+	case formatNDJSON:
+		return readNDJSONEntries(path)
+	case formatList:
+		return readListEntries(path, record)
+	case formatCSV:
+		return readCSVEntries(path)
+	default:
+		return nil, fmt.Errorf("unknown format %q, must be one of: json, ndjson, list, csv", format)
+	}
+}
+
+// readJSONEntries decodes an import JSON object and returns its entries in
+// the order they appear in the file.
+func readJSONEntries(path string) ([]importEntry, error) {
+	file, err := os.Open(path)
+	if err != nil {
+		return nil, fmt.Errorf("failed to open input: %v", err)
+	}
+	defer file.Close()
+
+	dec := json.NewDecoder(file)
+	if tok, err := dec.Token(); err != nil || tok != json.Delim('{') {
+		return nil, fmt.Errorf("failed to parse JSON in %s: expected an object of networks", path)
+	}
+
+	var entries []importEntry
+	for dec.More() {
+		tok, err := dec.Token()
+		if err != nil {
+			return nil, fmt.Errorf("failed to parse JSON in %s: %v", path, err)
+		}
+		key := tok.(string)
+
+		var record interface{}
+		if err := dec.Decode(&record); err != nil {
+			return nil, fmt.Errorf("failed to parse JSON record for %s: %v", key, err)
+		}
+		entries = append(entries, importEntry{Key: key, Index: len(entries), Record: record, Source: path})
+	}
+	if _, err := dec.Token(); err != nil {
+		return nil, fmt.Errorf("failed to parse JSON in %s: %v", path, err)
+	}
+	return entries, nil
+}
+
+// readNDJSONEntries reads newline-delimited JSON where each line is an object
+// in the import format, usually holding a single network.
+func readNDJSONEntries(path string) ([]importEntry, error) {
+	file, err := os.Open(path)
+	if err != nil {
+		return nil, fmt.Errorf("failed to open input: %v", err)
+	}
+	defer file.Close()
+
+	var entries []importEntry
+	scanner := bufio.NewScanner(file)
+	scanner.Buffer(make([]byte, 0, 64*1024), 64*1024*1024)
+	lineNum := 0
+	for scanner.Scan() {
+		lineNum++
+		line := strings.TrimSpace(scanner.Text())
+		if line == "" {
+			continue
+		}
+
+		dec := json.NewDecoder(strings.NewReader(line))
+		if tok, err := dec.Token(); err != nil || tok != json.Delim('{') {
+			return nil, fmt.Errorf("failed to parse line %d of %s: expected an object", lineNum, path)
+		}
+		for dec.More() {
+			tok, err := dec.Token()
+			if err != nil {
+				return nil, fmt.Errorf("failed to parse line %d of %s: %v", lineNum, path, err)
+			}
+			key := tok.(string)
+
+			var record interface{}
+			if err := dec.Decode(&record); err != nil {
+				return nil, fmt.Errorf("failed to parse record for %s on line %d: %v", key, lineNum, err)
+			}
+			entries = append(entries, importEntry{Key: key, Index: len(entries), Record: record, Source: path})
+		}
+	}
+	if err := scanner.Err(); err != nil {
+		return nil, fmt.Errorf("failed to read %s: %v", path, err)
+	}
+	return entries, nil
+}
+
+// readCSVEntries reads a CSV file with a header row. The column named
+// "network", or else the first column, holds the key; every other column is
+// a field of the record, with dots in the header nesting it, e.g.
+// "country.iso_code". Empty cells are left out, and cells holding a JSON
+// number, true or false are stored as such; everything else is a string.
+func readCSVEntries(path string) ([]importEntry, error) {
+	file, err := os.Open(path)
+	if err != nil {
+		return nil, fmt.Errorf("failed to open input: %v", err)
+	}
+	defer file.Close()
+
+	r := csv.NewReader(file)
+	r.FieldsPerRecord = -1
+	r.TrimLeadingSpace = true
+	header, err := r.Read()
+	if err != nil {
+		return nil, fmt.Errorf("failed to read CSV header of %s: %v", path, err)
+	}
+	keyColumn := 0
+	for i, name := range header {
+		header[i] = strings.TrimSpace(strings.TrimPrefix(name, "\ufeff"))
+		if header[i] == "network" {
+			keyColumn = i
+		}
+	}
+
+	var entries []importEntry
+	for {
+		row, err := r.Read()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			return nil, fmt.Errorf("failed to parse CSV in %s: %v", path, err)
+		}
+		if keyColumn >= len(row) || strings.TrimSpace(row[keyColumn]) == "" {
+			line, _ := r.FieldPos(0)
+			return nil, fmt.Errorf("failed to parse line %d of %s: missing network", line, path)
+		}
+
+		record := map[string]interface{}{}
+		for i, cell := range row {
+			if i == keyColumn || i >= len(header) || cell == "" {
+				continue
+			}
+			setFieldPath(record, strings.Split(header[i], "."), csvValue(cell))
+		}
+		entries = append(entries, importEntry{Key: strings.TrimSpace(row[keyColumn]), Index: len(entries), Record: record, Source: path})
+	}
+	return entries, nil
+}
+
+// csvValue returns a CSV cell as a number or boolean if it is written as a
+// JSON one, and as a string otherwise.
+func csvValue(cell string) interface{} {
+	var v interface{}
+	if err := json.Unmarshal([]byte(cell), &v); err == nil {
+		switch v.(type) {
+		case float64, bool:
+			return v
+		}
+	}
+	return cell
+}
+
+// readListEntries reads a plain list of CIDRs, IPs or ranges, one per line.
+// Every network gets the record rendered from template for this file.
+func readListEntries(path, template string) ([]importEntry, error) {
+	record, err := renderListRecord(template, path)
+	if err != nil {
+		return nil, err
+	}
+	lines, err := readListLines(path)
+	if err != nil {
+		return nil, err
+	}
+
+	entries := make([]importEntry, 0, len(lines))
+	for _, line := range lines {
+		entries = append(entries, importEntry{Key: line, Index: len(entries), Record: record, Source: path})
+	}
+	return entries, nil
+}
+
+// readListLines returns the non-empty lines of a list file. Comments starting
+// with "#", ";" or "//" are stripped and surrounding whitespace is trimmed.
+func readListLines(path string) ([]string, error) {
+	file, err := os.Open(path)
+	if err != nil {
+		return nil, fmt.Errorf("failed to open input: %v", err)
+	}
+	defer file.Close()
+
+	var lines []string
+	scanner := bufio.NewScanner(file)
+	for scanner.Scan() {
+		line := scanner.Text()
+		for _, marker := range []string{"#", ";", "//"} {
+			if i := strings.Index(line, marker); i >= 0 {
+				line = line[:i]
+			}
+		}
+		line = strings.TrimSpace(line)
+		if line == "" {
+			continue
+		}
+		lines = append(lines, line)
+	}
+	if err := scanner.Err(); err != nil {
+		return nil, fmt.Errorf("failed to read %s: %v", path, err)
+	}
+	return lines, nil
+}
+
+// renderListRecord parses the --record JSON template and replaces the
+// placeholders in its string values: {{name}} is the file name without
+// extension and {{file}} is the file name.
+func renderListRecord(template, path string) (interface{}, error) {
+	var record interface{}
+	if err := json.Unmarshal([]byte(template), &record); err != nil {
+		return nil, fmt.Errorf("failed to parse --record: %v", err)
+	}
+	base := filepath.Base(path)
+	replacer := strings.NewReplacer(
+		"{{name}}", strings.TrimSuffix(base, filepath.Ext(base)),
+		"{{file}}", base,
+	)
+	return renderTemplateValue(record, replacer), nil
+}
+
+// renderTemplateValue applies replacer to every string in v.
+func renderTemplateValue(v interface{}, replacer *strings.Replacer) interface{} {
+	switch t := v.(type) {
+	case string:
+		return replacer.Replace(t)
+	case map[string]interface{}:
+		out := make(map[string]interface{}, len(t))
+		for k, val := range t {
+			out[replacer.Replace(k)] = renderTemplateValue(val, replacer)
+		}
+		return out
+	case []interface{}:
+		out := make([]interface{}, len(t))
+		for i, val := range t {
+			out[i] = renderTemplateValue(val, replacer)
+		}
+		return out
+	default:
+		return v
+	}
+}
@@ -0,0 +1,206 @@
+package cmd
+
+import (
+	"fmt"
+	"math/big"
+	"strings"
+
+	"github.com/maxmind/mmdbwriter/mmdbtype"
+)
+
+// mmdbValueDecoder rebuilds a record as mmdbtype values, keeping the exact
+// type every value is stored with. It implements the deserializer interface
+// of maxminddb and is passed to Networks.Network or Reader.Decode in place
+// of a result value.
+type mmdbValueDecoder struct {
+	stack  []*mmdbContainer
+	result mmdbtype.DataType
+
+	// visit, if set, is called for every value as it is decoded, with the
+	// way it is stored in the data section.
+	visit func(wireValue)
+	// collapseArrays makes the paths given to visit end array elements in
+	// "[]" instead of "[0]", "[1]", ...
+	collapseArrays bool
+	// skips counts the data offsets visited since the last value. The
+	// decoder visits the offset of a pointer and then the one it points
+	// to, so two or more mean the value is stored behind a pointer.
+	skips int
+}
+
+// mmdbContainer is a map or array being decoded.
+type mmdbContainer struct {
+	isMap bool
+	m     mmdbtype.Map
+	s     mmdbtype.Slice
+	key   *mmdbtype.String
+	path  string
+}
+
+// MMDB data section type names, as in the MaxMind DB specification.
+const (
+	wireMap     = "map"
+	wireArray   = "array"
+	wireString  = "utf8_string"
+	wireDouble  = "double"
+	wireFloat   = "float"
+	wireBytes   = "bytes"
+	wireUint16  = "uint16"
+	wireUint32  = "uint32"
+	wireUint64  = "uint64"
+	wireUint128 = "uint128"
+	wireInt32   = "int32"
+	wireBoolean = "boolean"
+)
+
+// wireValue describes one decoded value as it is stored.
+type wireValue struct {
+	// Path is the dot-separated path of the value in the record, "" for
+	// the record itself.
+	Path string
+	// Type is the MMDB type of the value.
+	Type string
+	// Pointer is set if the value is stored once and referenced by a
+	// pointer, as writers do for repeated values.
+	Pointer bool
+	// Size is the number of entries of a map or array, otherwise 0.
+	Size int
+	// Value is the decoded value; nil for maps and arrays.
+	Value mmdbtype.DataType
+}
+
+// decodeTyped returns the decoded record and resets d for the next one.
+func (d *mmdbValueDecoder) decodeTyped() mmdbtype.DataType {
+	v := d.result
+	d.result = nil
+	d.stack = d.stack[:0]
+	d.skips = 0
+	return v
+}
+
+// valuePath returns the path of the value about to be added.
+func (d *mmdbValueDecoder) valuePath() string {
+	if len(d.stack) == 0 {
+		return ""
+	}
+	top := d.stack[len(d.stack)-1]
+	if !top.isMap {
+		if d.collapseArrays {
+			return top.path + "[]"
+		}
+		return fmt.Sprintf("%s[%d]", top.path, len(top.s))
+	}
+	if top.key == nil {
+		return top.path
+	}
+	if top.path == "" {
+		return string(*top.key)
+	}
+	return top.path + "." + string(*top.key)
+}
+
+// observe reports a value that is about to be added to visit. Map keys are
+// not reported.
+func (d *mmdbValueDecoder) observe(typ string, size int, v mmdbtype.DataType) {
+	pointer := d.skips > 1
+	d.skips = 0
+	if d.visit == nil {
+		return
+	}
+	if n := len(d.stack); n > 0 && d.stack[n-1].isMap && d.stack[n-1].key == nil {
+		return
+	}
+	d.visit(wireValue{Path: d.valuePath(), Type: typ, Pointer: pointer, Size: size, Value: v})
+}
+
+// add stores v in the innermost container, or as the result.
+func (d *mmdbValueDecoder) add(v mmdbtype.DataType) error {
+	if len(d.stack) == 0 {
+		d.result = v
+		return nil
+	}
+	top := d.stack[len(d.stack)-1]
+	if !top.isMap {
+		top.s = append(top.s, v)
+		return nil
+	}
+	if top.key == nil {
+		key, ok := v.(mmdbtype.String)
+		if !ok {
+			return fmt.Errorf("map key has type %T, expected string", v)
+		}
+		top.key = &key
+		return nil
+	}
+	top.m[*top.key] = v
+	top.key = nil
+	return nil
+}
+
+func (d *mmdbValueDecoder) ShouldSkip(offset uintptr) (bool, error) {
+	d.skips++
+	return false, nil
+}
+
+func (d *mmdbValueDecoder) StartSlice(size uint) error {
+	path := d.valuePath()
+	d.observe(wireArray, int(size), nil)
+	d.stack = append(d.stack, &mmdbContainer{s: make(mmdbtype.Slice, 0, size), path: path})
+	return nil
+}
+
+func (d *mmdbValueDecoder) StartMap(size uint) error {
+	path := d.valuePath()
+	d.observe(wireMap, int(size), nil)
+	d.stack = append(d.stack, &mmdbContainer{isMap: true, m: make(mmdbtype.Map, size), path: path})
+	return nil
+}
+
+func (d *mmdbValueDecoder) End() error {
+	top := d.stack[len(d.stack)-1]
+	d.stack = d.stack[:len(d.stack)-1]
+	if top.isMap {
+		return d.add(top.m)
+	}
+	return d.add(top.s)
+}
+
+// scalar reports and adds a value that is not a map or array.
+func (d *mmdbValueDecoder) scalar(typ string, v mmdbtype.DataType) error {
+	d.observe(typ, 0, v)
+	return d.add(v)
+}
+
+func (d *mmdbValueDecoder) String(v string) error   { return d.scalar(wireString, mmdbtype.String(v)) }
+func (d *mmdbValueDecoder) Float64(v float64) error { return d.scalar(wireDouble, mmdbtype.Float64(v)) }
+func (d *mmdbValueDecoder) Bytes(v []byte) error {
+	return d.scalar(wireBytes, mmdbtype.Bytes(append([]byte(nil), v...)))
+}
+func (d *mmdbValueDecoder) Uint16(v uint16) error   { return d.scalar(wireUint16, mmdbtype.Uint16(v)) }
+func (d *mmdbValueDecoder) Uint32(v uint32) error   { return d.scalar(wireUint32, mmdbtype.Uint32(v)) }
+func (d *mmdbValueDecoder) Int32(v int32) error     { return d.scalar(wireInt32, mmdbtype.Int32(v)) }
+func (d *mmdbValueDecoder) Uint64(v uint64) error   { return d.scalar(wireUint64, mmdbtype.Uint64(v)) }
+func (d *mmdbValueDecoder) Bool(v bool) error       { return d.scalar(wireBoolean, mmdbtype.Bool(v)) }
+func (d *mmdbValueDecoder) Float32(v float32) error { return d.scalar(wireFloat, mmdbtype.Float32(v)) }
+
+func (d *mmdbValueDecoder) Uint128(v *big.Int) error {
+	u := mmdbtype.Uint128(*new(big.Int).Set(v))
+	return d.scalar(wireUint128, &u)
+}
+
+// typedField returns the value at a dot-separated path of maps in v.
+func typedField(v mmdbtype.DataType, path string) (mmdbtype.DataType, bool) {
+	if path == "" {
+		return v, true
+	}
+	for _, key := range strings.Split(path, ".") {
+		m, ok := v.(mmdbtype.Map)
+		if !ok {
+			return nil, false
+		}
+		if v, ok = m[mmdbtype.String(key)]; !ok {
+			return nil, false
+		}
+	}
+	return v, true
+}
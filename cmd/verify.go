@@ -1,6 +1,7 @@
 package cmd
 
 import (
+	"errors"
 	"fmt"
 	"os"
 
@@ -8,12 +9,35 @@ import (
 	"github.com/spf13/cobra"
 )
 
-var verifyDBPath string
+// Exit codes of verify. Every signature failure has its own code, so that
+// it is never mistaken for a corrupt database.
+const (
+	exitVerifyInvalid      = 1
+	exitVerifyBadSignature = 2
+	exitVerifyNoSignature  = 3
+	exitVerifyBadPublicKey = 4
+)
+
+var (
+	verifyDBPath  string
+	verifyPubPath string
+	verifySigPath string
+)
 
 var verifyCmd = &cobra.Command{
 	Use:   "verify",
 	Short: "Verify the validity of an MMDB file",
-	Long:  "Verify that an MMDB file is valid and readable. Returns exit code 0 if valid, 1 if invalid.",
+	Long: `Verify that an MMDB file is valid and readable. Returns exit code 0 if valid, 1 if invalid.
+
+With --pubkey, the detached Ed25519 signature written by "sign" (or
+"import --sign-key") is checked as well.
+
+Exit codes:
+  0  the file is valid (and, with --pubkey, the signature matches)
+  1  the file is not a valid MMDB database
+  2  bad signature: the signature does not match or is malformed
+  3  missing signature: the signature file does not exist or is unreadable
+  4  the public key cannot be read`,
 	Run: func(cmd *cobra.Command, args []string) {
 		if verifyDBPath == "" {
 			fmt.Println("Error: --db flag is required")
@@ -24,14 +48,40 @@ var verifyCmd = &cobra.Command{
 		db, err := maxminddb.Open(verifyDBPath)
 		if err != nil {
 			fmt.Printf("invalid: failed to open MMDB: %v\n", err)
-			os.Exit(1)
+			os.Exit(exitVerifyInvalid)
 		}
 		defer db.Close()
 
 		err = db.Verify()
 		if err != nil {
 			fmt.Printf("invalid: %v\n", err)
-			os.Exit(1)
+			os.Exit(exitVerifyInvalid)
+		}
+
+		if verifyPubPath != "" {
+			sigPath := verifySigPath
+			if sigPath == "" {
+				sigPath = verifyDBPath + signatureSuffix
+			}
+			pub, err := loadPublicKey(verifyPubPath)
+			if err != nil {
+				fmt.Printf("Error: %v\n", err)
+				os.Exit(exitVerifyBadPublicKey)
+			}
+			if err := verifyFileSignature(verifyDBPath, sigPath, pub); err != nil {
+				switch {
+				case errors.Is(err, errBadSignature):
+					fmt.Println(err)
+					os.Exit(exitVerifyBadSignature)
+				case errors.Is(err, errNoSignature):
+					fmt.Println(err)
+					os.Exit(exitVerifyNoSignature)
+				}
+				fmt.Printf("Error: %v\n", err)
+				os.Exit(exitVerifyInvalid)
+			}
+			fmt.Println("valid, signature verified")
+			os.Exit(0)
 		}
 
 		fmt.Println("valid")
@@ -43,4 +93,6 @@ func init() {
 	rootCmd.AddCommand(verifyCmd)
 
 	verifyCmd.Flags().StringVar(&verifyDBPath, "db", "", "Path to the .mmdb file")
+	verifyCmd.Flags().StringVar(&verifyPubPath, "pubkey", "", "Ed25519 public key (PEM) to check the signature with")
+	verifyCmd.Flags().StringVar(&verifySigPath, "sig", "", "Signature file (defaults to <db>.sig)")
 }